@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// audit looks up the password of every stored site and the master password
+// in a downloaded Pwned Passwords list. Nothing is sent over the network.
+func audit(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	hibpPath := fs.String("hibp", "", "Pwned Passwords SHA-1 or NTLM list ordered by hash")
+	fs.Parse(args)
+	if fs.NArg() != 0 || *hibpPath == "" {
+		fmt.Println("usage: mpw audit --hibp FILE")
+		os.Exit(1)
+	}
+	list, err := mpw.OpenHashList(*hibpPath)
+	if err != nil {
+		fmt.Printf("error opening %s: %s\n", *hibpPath, err.Error())
+		os.Exit(1)
+	}
+	defer list.Close()
+	config, err := readConfig()
+	if err != nil {
+		fmt.Printf("error reading config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if config.FullName == "" {
+		fmt.Println("FULL_NAME missing in the config")
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	masterPassword, err := askMasterPassword()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	keys, err := mpw.MasterKeys(config.FullName, masterPassword)
+	if err != nil {
+		fmt.Printf("error deriving master keys: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	breached := 0
+	report := func(name string, counter string, count int) {
+		if breached == 0 {
+			fmt.Fprintln(w, "SITE\tCOUNTER\tSEEN")
+		}
+		breached++
+		fmt.Fprintf(w, "%s\t%s\t%d times\n", name, counter, count)
+	}
+	count, err := list.Count(masterPassword)
+	if err != nil {
+		fmt.Printf("error reading %s: %s\n", *hibpPath, err.Error())
+		os.Exit(1)
+	}
+	if count > 0 {
+		report("(master password)", "-", count)
+	}
+	for _, site := range sites {
+		password, err := sitePassword(keys, site)
+		if err != nil {
+			fmt.Printf("password generation error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		count, err := list.Count(password)
+		if err != nil {
+			fmt.Printf("error reading %s: %s\n", *hibpPath, err.Error())
+			os.Exit(1)
+		}
+		if count > 0 {
+			report(site.Name, fmt.Sprint(siteCounter(site)), count)
+		}
+	}
+	w.Flush()
+	if breached == 0 {
+		fmt.Printf("Neither the master password nor the passwords of %d sites are in %s.\n", len(sites), *hibpPath)
+		return
+	}
+	fmt.Println("\nChange the master password with mpw migrate-master, and the password of a site with mpw rotate.")
+	os.Exit(1)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// Shell completion
+//
+// The generated scripts are thin wrappers that call back into the hidden
+// __complete command with the words on the command line, so that flags,
+// result types, subcommands and site names are always completed from the
+// current binary and sites store.
+var completionScripts = map[string]string{
+	"bash": `_mpw() {
+	local IFS=$'\n'
+	COMPREPLY=($(mpw __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _mpw mpw
+`,
+	"zsh": `#compdef mpw
+
+_mpw() {
+	local -a candidates
+	candidates=("${(@f)$(mpw __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	compadd -Q -a candidates
+}
+
+compdef _mpw mpw
+`,
+	"fish": `function __mpw_complete
+	set -l tokens (commandline -opc) (commandline -ct)
+	mpw __complete $tokens[2..-1] 2>/dev/null
+end
+
+complete -c mpw -f -a '(__mpw_complete)'
+`,
+}
+
+func completion(args []string) {
+	if len(args) != 1 {
+		fmt.Println("usage: mpw completion bash|zsh|fish")
+		os.Exit(1)
+	}
+	script, found := completionScripts[args[0]]
+	if !found {
+		fmt.Printf("unsupported shell: %s\n", args[0])
+		os.Exit(1)
+	}
+	fmt.Print(script)
+}
+
+// complete prints the candidates for the last of args, the words typed
+// after the program name, one per line.
+func complete(args []string) {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	for _, candidate := range completions(args[:len(args)-1], args[len(args)-1]) {
+		fmt.Println(candidate)
+	}
+}
+
+func completions(previous []string, current string) []string {
+	fs := flag.NewFlagSet("mpw", flag.ContinueOnError)
+	parseFlags(fs, nil)
+	takesValue := func(name string) bool {
+		f := fs.Lookup(strings.TrimLeft(name, "-"))
+		if f == nil {
+			return false
+		}
+		boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+		return !ok || !boolFlag.IsBoolFlag()
+	}
+
+	if strings.HasPrefix(current, "-") {
+		if name, _, found := strings.Cut(current, "="); found {
+			return withPrefix(name+"=", flagValues(name), current)
+		}
+		var names []string
+		fs.VisitAll(func(f *flag.Flag) {
+			if len(f.Name) == 1 {
+				names = append(names, "-"+f.Name)
+			} else {
+				names = append(names, "--"+f.Name)
+			}
+		})
+		return withPrefix("", names, current)
+	}
+	var positional []string
+	for i := 0; i < len(previous); i++ {
+		word := previous[i]
+		if strings.HasPrefix(word, "-") {
+			if strings.Contains(word, "=") || !takesValue(word) {
+				continue
+			}
+			if i == len(previous)-1 {
+				return withPrefix("", flagValues(word), current)
+			}
+			i++
+			continue
+		}
+		positional = append(positional, word)
+	}
+	if len(positional) == 0 {
+		var candidates []string
+		for name := range commands {
+			if !strings.HasPrefix(name, "__") {
+				candidates = append(candidates, name)
+			}
+		}
+		sort.Strings(candidates)
+		return withPrefix("", append(candidates, siteNames()...), current)
+	}
+	switch positional[0] {
+	case "completion":
+		if len(positional) == 1 {
+			shells := make([]string, 0, len(completionScripts))
+			for shell := range completionScripts {
+				shells = append(shells, shell)
+			}
+			sort.Strings(shells)
+			return withPrefix("", shells, current)
+		}
+	case "docker-credential":
+		if len(positional) == 1 {
+			return withPrefix("", []string{"erase", "get", "list", "store"}, current)
+		}
+	case "explain":
+		if len(positional) == 1 {
+			return withPrefix("", siteNames(), current)
+		}
+		return withPrefix("", []string{"counter=", "type=", "purpose=", "context="}, current)
+	case "annotate", "identify", "policy", "rotate", "show", "ssh-pubkey", "wireguard":
+		if len(positional) == 1 {
+			return withPrefix("", siteNames(), current)
+		}
+	case "ssh-agent":
+		return withPrefix("", siteNames(), current)
+	case "git-credential":
+		if len(positional) == 1 {
+			return withPrefix("", []string{"erase", "get", "store"}, current)
+		}
+	case "native-host":
+		if len(positional) == 1 {
+			return withPrefix("", []string{"install"}, current)
+		}
+	}
+	return nil
+}
+
+// flagValues lists the known values of the flag name.
+func flagValues(name string) []string {
+	switch strings.TrimLeft(name, "-") {
+	case "t", "site-result-type":
+		var types []string
+		for resultType := range mpw.TemplateDictionary {
+			types = append(types, string(resultType))
+		}
+		types = append(types, string(mpw.Words))
+		for abbreviation := range typeAbbreviations {
+			types = append(types, string(abbreviation))
+		}
+		sort.Strings(types)
+		return types
+	case "capitalize":
+		return []string{string(mpw.Lowercase), string(mpw.Titlecase), string(mpw.Uppercase)}
+	}
+	return nil
+}
+
+// siteNames lists the names in the sites store and the history. An
+// encrypted store is not unlocked for it, so that completion lists none.
+func siteNames() []string {
+	if sitesEncrypted() {
+		return nil
+	}
+	sites, _ := mpw.ReadSites(sitesPath())
+	history, _ := mpw.ReadHistory(historyPath())
+	return candidateNames(sites, history)
+}
+
+func candidateNames(sites []mpw.Site, history []string) []string {
+	var names []string
+	for _, site := range pickerCandidates(sites, history) {
+		names = append(names, site.Name)
+	}
+	return names
+}
+
+func withPrefix(prefix string, candidates []string, current string) []string {
+	var matching []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(prefix+candidate, current) {
+			matching = append(matching, prefix+candidate)
+		}
+	}
+	return matching
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+func TestCompleteSiteNames(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	require.NoError(t, writeSites([]mpw.Site{{Name: "github.com"}}))
+
+	// The commands taking a site name as their first argument.
+	siteCommands := map[string]bool{
+		"annotate":   true,
+		"explain":    true,
+		"identify":   true,
+		"policy":     true,
+		"rotate":     true,
+		"show":       true,
+		"ssh-agent":  true,
+		"ssh-pubkey": true,
+		"wireguard":  true,
+	}
+	for name := range commands {
+		if strings.HasPrefix(name, "__") {
+			continue
+		}
+		var expected []string
+		if siteCommands[name] {
+			expected = []string{"github.com"}
+		}
+		require.Equal(t, expected, completions([]string{name}, "git"), name)
+	}
+	require.Equal(t, []string{"github.com"}, completions([]string{"ssh-agent", "github.com"}, "git"))
+	require.Empty(t, completions([]string{"wireguard", "github.com"}, "git"))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// dockerCredential is the body of Docker's credential helper protocol.
+type dockerCredential struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// dockerCredentialCommand implements Docker's credential helper protocol.
+// Like the reference helpers, errors are reported on stdout. Only the site
+// parameters are ever stored, the secret is derived on get.
+func dockerCredentialCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("usage: docker-credential-mpw get|store|erase|list")
+		os.Exit(1)
+	}
+	err := dockerCredentialAction(args[0], os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
+
+func dockerCredentialAction(action string, in io.Reader, out io.Writer) error {
+	sites, err := readSites()
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "get":
+		serverURL, err := readServerURL(in)
+		if err != nil {
+			return err
+		}
+		site, _, err := registrySite(sites, serverURL)
+		if err != nil {
+			return err
+		}
+		keys, err := unlockMasterKeys()
+		if err != nil {
+			return err
+		}
+		login, err := loginName(keys[mpw.CurrentAlgorithm], site)
+		if err != nil {
+			return err
+		}
+		password, err := sitePassword(keys, site)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(out).Encode(dockerCredential{ServerURL: serverURL, Username: login, Secret: password})
+	case "store":
+		var credential dockerCredential
+		err := json.NewDecoder(in).Decode(&credential)
+		if err != nil {
+			return err
+		}
+		site, found, err := registrySite(sites, credential.ServerURL)
+		if err != nil {
+			return err
+		}
+		if credential.Username == "" || (found && site.Login == credential.Username && site.Registry == credential.ServerURL) {
+			return nil
+		}
+		site.Login = credential.Username
+		site.Registry = credential.ServerURL
+		return writeSites(mpw.PutSite(sites, site))
+	case "erase":
+		serverURL, err := readServerURL(in)
+		if err != nil {
+			return err
+		}
+		site, found, err := registrySite(sites, serverURL)
+		if err != nil {
+			return err
+		}
+		if !found || site.Registry == "" {
+			return nil
+		}
+		site.Login = ""
+		site.Registry = ""
+		return writeSites(removeEmptySite(mpw.PutSite(sites, site), site))
+	case "list":
+		// Docker lists the registries it stored a credential for by the
+		// server URL it stored it under.
+		registries := map[string]string{}
+		for _, site := range sites {
+			if site.Registry != "" {
+				registries[site.Registry] = site.Login
+			}
+		}
+		return json.NewEncoder(out).Encode(registries)
+	}
+	return fmt.Errorf("unknown action: %s", action)
+}
+
+func readServerURL(in io.Reader) (string, error) {
+	b, err := io.ReadAll(in)
+	if err != nil {
+		return "", err
+	}
+	serverURL := strings.TrimSpace(string(b))
+	if serverURL == "" {
+		return "", errors.New("no credentials server URL")
+	}
+	return serverURL, nil
+}
+
+// registrySite maps the server URL of a registry to its site, which
+// defaults to the canonical host name of the registry.
+func registrySite(sites []mpw.Site, serverURL string) (mpw.Site, bool, error) {
+	siteName, err := mpw.CanonicalSiteName(serverURL)
+	if err != nil {
+		return mpw.Site{}, false, err
+	}
+	site, found := mpw.FindSite(sites, siteName)
+	if !found {
+		site = mpw.Site{Name: siteName}
+	}
+	return site, found, nil
+}
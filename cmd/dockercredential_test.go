@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+func dockerList(t *testing.T) map[string]string {
+	var out bytes.Buffer
+	require.NoError(t, dockerCredentialAction("list", strings.NewReader(""), &out))
+	var registries map[string]string
+	require.NoError(t, json.Unmarshal(out.Bytes(), &registries))
+	return registries
+}
+
+func TestDockerCredentialList(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	require.NoError(t, writeSites([]mpw.Site{{Name: "github.com", Login: "rob"}}))
+
+	credential := `{"ServerURL":"https://ghcr.io/v2/","Username":"rob","Secret":"ignored"}`
+	require.NoError(t, dockerCredentialAction("store", strings.NewReader(credential), &bytes.Buffer{}))
+	require.Equal(t, map[string]string{"https://ghcr.io/v2/": "rob"}, dockerList(t))
+
+	require.NoError(t, dockerCredentialAction("erase", strings.NewReader("https://ghcr.io/v2/"), &bytes.Buffer{}))
+	require.Empty(t, dockerList(t))
+	sites, err := readSites()
+	require.NoError(t, err)
+	require.Len(t, sites, 1)
+	require.Equal(t, "github.com", sites[0].Name)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// dueSite is a line of mpw due's report, the form of its JSON output.
+type dueSite struct {
+	Site       string     `json:"site"`
+	Counter    int        `json:"counter"`
+	Since      *time.Time `json:"since"`
+	AgeDays    *int       `json:"age_days"`
+	MaxAgeDays int        `json:"max_age_days"`
+	Due        bool       `json:"due"`
+}
+
+// due lists the sites whose password is older than their rotation policy.
+func due(args []string) {
+	fs := flag.NewFlagSet("due", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Print the report as JSON")
+	all := fs.Bool("all", false, "List all sites with a rotation policy, not only those that are due")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Println("usage: mpw due [--json] [--all]")
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	now := time.Now()
+	report := []dueSite{}
+	for _, site := range sites {
+		if site.MaxAgeDays <= 0 {
+			continue
+		}
+		line := dueSite{
+			Site:       site.Name,
+			Counter:    siteCounter(site),
+			Since:      site.Since,
+			MaxAgeDays: site.MaxAgeDays,
+			Due:        mpw.RotationDue(site, now),
+		}
+		if site.Since != nil {
+			age := int(math.Floor(now.Sub(*site.Since).Hours() / 24))
+			line.AgeDays = &age
+		}
+		if line.Due || *all {
+			report = append(report, line)
+		}
+	}
+
+	if *jsonOutput {
+		b, err := json.MarshalIndent(report, "", "\t")
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		fmt.Println(string(b))
+		return
+	}
+	if len(report) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SITE\tCOUNTER\tSINCE\tAGE\tMAX AGE\tDUE")
+	for _, line := range report {
+		since, age := "unknown", "unknown"
+		if line.Since != nil {
+			since = line.Since.Local().Format("2006-01-02")
+			age = fmt.Sprintf("%d days", *line.AgeDays)
+		}
+		dueText := "no"
+		if line.Due {
+			dueText = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%d days\t%s\n", line.Site, line.Counter, since, age, line.MaxAgeDays, dueText)
+	}
+	w.Flush()
+}
+
+// policy sets the rotation policy of a site.
+func policy(args []string) {
+	fs := flag.NewFlagSet("policy", flag.ExitOnError)
+	maxAge := fs.Int("max-age", 0, "Days after which the password is due for rotation, 0 removes the policy")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 || *maxAge < 0 {
+		fmt.Println("usage: mpw policy SITE --max-age DAYS")
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	site, found := mpw.FindSite(sites, positional[0])
+	if !found {
+		site = mpw.Site{Name: positional[0]}
+	}
+	site.MaxAgeDays = *maxAge
+	err = writeSites(mpw.PutSite(sites, site))
+	if err != nil {
+		fmt.Printf("error writing sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+// recordUse records when the current password of a stored site was first
+// used. Sites that are not stored are not added for it.
+func recordUse(siteName string) error {
+	sites, err := readSites()
+	if err != nil {
+		return err
+	}
+	site, found := mpw.FindSite(sites, siteName)
+	if !found {
+		return nil
+	}
+	site, changed := mpw.UseSite(site, time.Now())
+	if !changed {
+		return nil
+	}
+	return writeSites(mpw.PutSite(sites, site))
+}
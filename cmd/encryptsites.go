@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// encryptSites encrypts the sites store and the history under the master
+// key, or decrypts them again. Every command reading the store then asks
+// for the master password, except shell completion, which completes no
+// site names.
+func encryptSites(args []string) {
+	fs := flag.NewFlagSet("encrypt-sites", flag.ExitOnError)
+	decrypt := fs.Bool("decrypt", false, "Store the sites unencrypted again")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Println("usage: mpw encrypt-sites [--decrypt]")
+		os.Exit(1)
+	}
+	if sitesEncrypted() != *decrypt {
+		if *decrypt {
+			fmt.Println("the sites store is not encrypted")
+		} else {
+			fmt.Println("the sites store is encrypted already")
+		}
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	history, err := readHistory()
+	if err != nil {
+		fmt.Printf("error reading history: %s\n", err.Error())
+		os.Exit(1)
+	}
+	masterKey, err := unlockMasterKey()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if *decrypt {
+		err = mpw.WriteSites(sitesPath(), sites)
+		if err == nil && history != nil {
+			err = mpw.WriteEncryptedHistory(historyPath(), nil, history)
+		}
+	} else {
+		err = mpw.WriteEncryptedSites(sitesPath(), masterKey, sites)
+		if err == nil && history != nil {
+			err = mpw.WriteEncryptedHistory(historyPath(), masterKey, history)
+		}
+		if err == nil {
+			fmt.Printf("Sites encrypted under key ID %s\n", mpw.KeyID(masterKey))
+		}
+	}
+	if err != nil {
+		fmt.Printf("error writing sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
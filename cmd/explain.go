@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// explain shows how the password of a site was rendered from its site key,
+// to understand why a site rejects it. The site is given like the lines of
+// mpw run's env file, e.g. mpw explain example.com counter=2 type=Basic.
+func explain(args []string) {
+	if len(args) == 0 {
+		fmt.Println("usage: mpw explain SITE [counter=N] [type=T] [purpose=P] [context=C]")
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	spec, err := parseSiteSpec(args, sites)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if spec.Login != "" {
+		fmt.Printf("The login of %s is stored, not derived, give a counter or type to explain the derived one.\n", spec.Name)
+		os.Exit(1)
+	}
+	keys, err := unlockMasterKeys()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if spec.Algorithm < 0 || spec.Algorithm >= len(keys) {
+		fmt.Printf("%s: algorithm version %d not found\n", spec.Name, spec.Algorithm)
+		os.Exit(1)
+	}
+	explanation, err := mpw.Explain(spec.Algorithm, keys[spec.Algorithm], spec.Name, spec.Counter, spec.Purpose, spec.Context, spec.Type)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Site:     %s, counter %d, %s, algorithm %d\n", spec.Name, spec.Counter, spec.Purpose, spec.Algorithm)
+	fmt.Printf("Type:     %s, template %d of %d picked by site key byte 0\n",
+		explanation.Type, explanation.TemplateIndex+1, explanation.Templates)
+	fmt.Printf("Template: %s\n", explanation.Template)
+	fmt.Printf("Password: %s\n\n", explanation.Password)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "POSITION\tCHARACTER\tCLASS\tALPHABET\tSITE KEY BYTE")
+	for i, c := range explanation.Characters {
+		fmt.Fprintf(w, "%d\t%q\t%c %s\t%d\t%d\n",
+			i+1, c.Character, c.Class, mpw.TemplateClassNames[c.Class], c.AlphabetSize, c.KeyByte)
+	}
+	w.Flush()
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// export writes the sites with their derived logins and passwords in the
+// format of another password manager, for access without mpw.
+func export(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "kdbx", "Format of the export: "+strings.Join(exportFormats(), ", "))
+	outputPath := fs.String("o", "", "File to write")
+	force := fs.Bool("force", false, "Overwrite the output file if it exists")
+	fs.Parse(args)
+	if *outputPath == "" || fs.NArg() != 0 {
+		fmt.Printf("usage: mpw export [--format %s] -o FILE [--force]\n", strings.Join(exportFormats(), "|"))
+		os.Exit(1)
+	}
+	if !validFormat(*format, exportFormats()) {
+		fmt.Printf("unsupported export format: %s\n", *format)
+		os.Exit(1)
+	}
+	if !*force {
+		if _, err := os.Lstat(*outputPath); err == nil {
+			fmt.Printf("%s exists, use --force to overwrite it\n", *outputPath)
+			os.Exit(1)
+		}
+	}
+	config, err := readConfig()
+	if err != nil {
+		fmt.Printf("error reading config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	keys, err := askMasterKeys(config.FullName)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	entries, err := vaultEntries(keys, sites)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	var file bytes.Buffer
+	if *format == "kdbx" {
+		password, err := exportPassword()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		err = mpw.WriteKDBX(&file, password, config.FullName, entries)
+	} else {
+		err = mpw.WriteVault(&file, mpw.VaultFormat(*format), entries)
+	}
+	if err != nil {
+		fmt.Printf("error writing export: %s\n", err.Error())
+		os.Exit(1)
+	}
+	err = mpw.WriteFileAtomic(*outputPath, file.Bytes(), *force)
+	if err != nil {
+		fmt.Printf("error writing %s: %s\n", *outputPath, err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("Exported %d sites to %s\n", len(entries), *outputPath)
+	if *format != "kdbx" {
+		fmt.Println("The passwords in it are not encrypted, delete it once it is imported.")
+	}
+}
+
+// exportFormats lists the formats sites are exported in.
+func exportFormats() []string {
+	formats := []string{"kdbx"}
+	for _, format := range mpw.VaultFormats {
+		formats = append(formats, string(format))
+	}
+	return formats
+}
+
+func validFormat(format string, formats []string) bool {
+	for _, valid := range formats {
+		if format == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// askMasterKeys asks for the master password and derives the master keys
+// of every algorithm version from it.
+func askMasterKeys(fullName string) ([][]byte, error) {
+	if fullName == "" {
+		return nil, errors.New("FULL_NAME missing in the config")
+	}
+	masterPassword, err := askMasterPassword()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := mpw.MasterKeys(fullName, masterPassword)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving master keys: %w", err)
+	}
+	return keys, nil
+}
+
+// vaultEntries derives the logins and passwords of the sites.
+func vaultEntries(keys [][]byte, sites []mpw.Site) ([]mpw.VaultEntry, error) {
+	var entries []mpw.VaultEntry
+	for _, site := range sites {
+		password, err := sitePassword(keys, site)
+		if err != nil {
+			return nil, fmt.Errorf("password generation error: %w", err)
+		}
+		login, err := loginName(keys[mpw.CurrentAlgorithm], site)
+		if err != nil {
+			return nil, fmt.Errorf("login name generation error: %w", err)
+		}
+		entries = append(entries, mpw.VaultEntry{
+			Title:    site.Name,
+			UserName: login,
+			Password: password,
+			URL:      site.URL,
+			Notes:    site.Notes,
+			Tags:     site.Tags,
+		})
+	}
+	return entries, nil
+}
+
+// exportPassword asks for the password of an export, twice.
+func exportPassword() (string, error) {
+	password, err := askSecret("Export Password: ")
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", errors.New("export password missing")
+	}
+	repeated, err := askSecret("Repeat Export Password: ")
+	if err != nil {
+		return "", err
+	}
+	if repeated != password {
+		return "", errors.New("export passwords do not match")
+	}
+	return password, nil
+}
+
+// annotate sets the URL, notes and tags of a site, which are exported with
+// it.
+func annotate(args []string) {
+	fs := flag.NewFlagSet("annotate", flag.ExitOnError)
+	url := fs.String("url", "", "URL of the site's login page")
+	notes := fs.String("notes", "", "Notes on the site")
+	tags := fs.String("tags", "", "Comma separated tags, the first is the site's group in exports")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fmt.Println("usage: mpw annotate SITE [--url URL] [--notes NOTES] [--tags TAG,...]")
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	site, found := mpw.FindSite(sites, positional[0])
+	if !found {
+		site = mpw.Site{Name: positional[0]}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "url":
+			site.URL = *url
+		case "notes":
+			site.Notes = *notes
+		case "tags":
+			site.Tags = nil
+			for _, tag := range strings.Split(*tags, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					site.Tags = append(site.Tags, tag)
+				}
+			}
+		}
+	})
+	err = writeSites(mpw.PutSite(sites, site))
+	if err != nil {
+		fmt.Printf("error writing sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// gitCredential implements git's credential helper protocol. Only the
+// site parameters are ever stored, the credentials are derived on get.
+func gitCredential(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: mpw git-credential get|store|erase")
+		os.Exit(1)
+	}
+	attributes, err := readCredentialAttributes(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading credential: %s\n", err.Error())
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	site, found, err := credentialSite(sites, attributes)
+	if err != nil {
+		// Not a credential for a host, leave it to the other helpers.
+		return
+	}
+	switch args[0] {
+	case "get":
+		keys, err := unlockMasterKeys()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		login := attributes["username"]
+		if login == "" {
+			login, err = loginName(keys[mpw.CurrentAlgorithm], site)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+		}
+		password, err := sitePassword(keys, site)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("username=%s\npassword=%s\n", login, password)
+		return
+	case "store":
+		username := attributes["username"]
+		if username == "" || (found && site.Login == username) {
+			return
+		}
+		site.Login = username
+		sites = mpw.PutSite(sites, site)
+	case "erase":
+		if !found || site.Login == "" {
+			return
+		}
+		site.Login = ""
+		sites = removeEmptySite(mpw.PutSite(sites, site), site)
+	default:
+		// Unknown actions are ignored as the protocol requires.
+		return
+	}
+	err = writeSites(sites)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+// readCredentialAttributes reads key=value lines up to a blank line.
+func readCredentialAttributes(r io.Reader) (map[string]string, error) {
+	attributes := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid line: %s", line)
+		}
+		attributes[key] = value
+	}
+	return attributes, scanner.Err()
+}
+
+// credentialSite maps the host and, if git is configured to send it, the
+// path of a credential to a site. A site stored as host/path takes
+// precedence over one stored for the host, which defaults to the canonical
+// host name. The protocol is ignored on purpose: sites are named by host
+// everywhere else too, so a host has the same password over http and https.
+func credentialSite(sites []mpw.Site, attributes map[string]string) (mpw.Site, bool, error) {
+	siteName, err := mpw.CanonicalSiteName(attributes["host"])
+	if err != nil {
+		return mpw.Site{}, false, err
+	}
+	if path := strings.TrimSuffix(strings.Trim(attributes["path"], "/"), ".git"); path != "" {
+		if site, found := mpw.FindSite(sites, siteName+"/"+path); found {
+			return site, true, nil
+		}
+	}
+	site, found := mpw.FindSite(sites, siteName)
+	if !found {
+		site = mpw.Site{Name: siteName}
+	}
+	return site, found, nil
+}
+
+// removeEmptySite drops site from sites if it no longer stores any of the
+// parameters set by the user, only bookkeeping like when it was modified or
+// its previous passwords.
+func removeEmptySite(sites []mpw.Site, site mpw.Site) []mpw.Site {
+	if site.Counter != 0 || site.Type != "" || site.Login != "" || site.Passphrase != nil ||
+		site.Algorithm != nil || site.URL != "" || site.Notes != "" || len(site.Tags) != 0 ||
+		site.Registry != "" || site.KeyCounter != 0 || site.MaxAgeDays != 0 {
+		return sites
+	}
+	kept := sites[:0]
+	for _, s := range sites {
+		if s.Name != site.Name {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// credentialHelper runs git-credential with input on stdin.
+func credentialHelper(t *testing.T, action, input string) {
+	stdin := filepath.Join(t.TempDir(), "stdin")
+	require.NoError(t, os.WriteFile(stdin, []byte(input), 0600))
+	f, err := os.Open(stdin)
+	require.NoError(t, err)
+	defer f.Close()
+	saved := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = saved }()
+	gitCredential([]string{action})
+}
+
+func TestGitCredentialStoreErase(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	credential := "protocol=https\nhost=github.com\nusername=rob\npassword=ignored\n\n"
+
+	credentialHelper(t, "store", credential)
+	sites, err := mpw.ReadSites(sitesPath())
+	require.NoError(t, err)
+	require.Len(t, sites, 1)
+	require.Equal(t, "rob", sites[0].Login)
+	require.NotNil(t, sites[0].Modified)
+
+	credentialHelper(t, "erase", strings.Replace(credential, "password=ignored\n", "", 1))
+	sites, err = mpw.ReadSites(sitesPath())
+	require.NoError(t, err)
+	require.Empty(t, sites)
+}
+
+func TestRemoveEmptySite(t *testing.T) {
+	sites := []mpw.Site{{Name: "github.com", Counter: 2}, {Name: "gitlab.com"}}
+	require.Equal(t, sites, removeEmptySite(append([]mpw.Site(nil), sites...), sites[0]))
+	require.Equal(t, sites[:1], removeEmptySite(append([]mpw.Site(nil), sites...), sites[1]))
+}
+
+func TestCredentialSiteProtocol(t *testing.T) {
+	sites := []mpw.Site{{Name: "github.com", Counter: 2}}
+	for _, protocol := range []string{"https", "http", ""} {
+		site, found, err := credentialSite(sites, map[string]string{"protocol": protocol, "host": "github.com"})
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, sites[0], site)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+type identifiedResult struct {
+	Counter   int
+	Type      mpw.ResultType
+	Algorithm int
+	Purpose   mpw.KeyPurpose
+}
+
+// identify searches the parameters that derive a known password of a site,
+// for when its counter was bumped and forgotten.
+func identify(args []string) {
+	fs := flag.NewFlagSet("identify", flag.ExitOnError)
+	maxCounter := fs.Int("max-counter", 100, "Highest site counter to search")
+	context := fs.String("C", "", "Key context of the password, e.g. a security question")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *maxCounter < 1 {
+		fmt.Println("usage: mpw identify [--max-counter N] [-C CONTEXT] SITE")
+		os.Exit(1)
+	}
+	siteName := fs.Arg(0)
+	config, err := readConfig()
+	if err != nil {
+		fmt.Printf("error reading config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if config.FullName == "" {
+		fmt.Println("FULL_NAME missing in the config")
+		os.Exit(1)
+	}
+	candidate, err := askSecret("Password to identify: ")
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	masterPassword, err := askMasterPassword()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	keys, err := mpw.MasterKeys(config.FullName, masterPassword)
+	if err != nil {
+		fmt.Printf("error deriving master keys: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	var found []identifiedResult
+	for counter := 1; counter <= *maxCounter; counter++ {
+		for algorithm := mpw.CurrentAlgorithm; algorithm >= 0; algorithm-- {
+			for _, purpose := range []mpw.KeyPurpose{mpw.Authentication, mpw.Identification, mpw.Recovery} {
+				for _, resultType := range resultTypes {
+					result, err := mpw.SiteResultForAlgorithm(algorithm, keys[algorithm], siteName, counter, purpose, *context, resultType)
+					if err != nil {
+						fmt.Printf("password generation error: %s\n", err.Error())
+						os.Exit(1)
+					}
+					if subtle.ConstantTimeCompare([]byte(result), []byte(candidate)) == 1 {
+						found = append(found, identifiedResult{counter, resultType, algorithm, purpose})
+					}
+				}
+			}
+		}
+	}
+	if len(found) == 0 {
+		fmt.Printf("No counter up to %d, type, algorithm version or purpose derives the password for %s.\n", *maxCounter, siteName)
+		os.Exit(1)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COUNTER\tTYPE\tALGORITHM\tPURPOSE")
+	for _, result := range found {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\n", result.Counter, result.Type, result.Algorithm, result.Purpose)
+	}
+	w.Flush()
+
+	// Only passwords can be stored, and only those whose master key is the
+	// current one that every other command derives.
+	var saveable []identifiedResult
+	for _, result := range found {
+		if result.Purpose == mpw.Authentication && bytes.Equal(keys[result.Algorithm], keys[mpw.CurrentAlgorithm]) {
+			saveable = append(saveable, result)
+		}
+	}
+	if len(saveable) != 1 || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return
+	}
+	result := saveable[0]
+	answer, err := input(fmt.Sprintf("Save counter %d, type %s and algorithm %d for %s? [y/N] ",
+		result.Counter, result.Type, result.Algorithm, siteName))
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+		return
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	site, _ := mpw.FindSite(sites, siteName)
+	site.Name = siteName
+	site.Counter = result.Counter
+	site.Type = result.Type
+	site.Algorithm = nil
+	if result.Algorithm != mpw.CurrentAlgorithm {
+		site.Algorithm = &result.Algorithm
+	}
+	err = writeSites(mpw.PutSite(sites, site))
+	if err != nil {
+		fmt.Printf("error writing sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
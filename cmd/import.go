@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// importVault adds the entries exported by another password manager to the
+// sites store, with their URLs, logins, notes and tags. Their passwords are
+// not stored, with --check they are compared to those mpw derives.
+func importVault(args []string) {
+	var formats []string
+	for _, format := range mpw.VaultFormats {
+		formats = append(formats, string(format))
+	}
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "", "Format of the file: "+strings.Join(formats, ", "))
+	check := fs.Bool("check", false, "Report whether the passwords in the file are those mpw derives")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 || *format == "" {
+		fmt.Printf("usage: mpw import --format %s [--check] FILE\n", strings.Join(formats, "|"))
+		os.Exit(1)
+	}
+	if !validFormat(*format, formats) {
+		fmt.Printf("unsupported import format: %s\n", *format)
+		os.Exit(1)
+	}
+	f, err := os.Open(positional[0])
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	entries, err := mpw.ReadVault(f, mpw.VaultFormat(*format))
+	f.Close()
+	if err != nil {
+		fmt.Printf("error reading %s: %s\n", positional[0], err.Error())
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	var keys [][]byte
+	if *check {
+		config, err := readConfig()
+		if err != nil {
+			fmt.Printf("error reading config: %s\n", err.Error())
+			os.Exit(1)
+		}
+		keys, err = askMasterKeys(config.FullName)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if *check {
+		fmt.Fprintln(w, "SITE\tTITLE\tPASSWORD")
+	}
+	imported := map[string]string{}
+	for _, entry := range entries {
+		name, err := importedSiteName(entry, imported)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping an entry: %s\n", err.Error())
+			continue
+		}
+		site, _ := mpw.FindSite(sites, name)
+		site = importEntry(site, name, entry)
+		sites = mpw.PutSite(sites, site)
+		imported[name] = entry.UserName
+		if !*check || entry.Password == "" {
+			continue
+		}
+		password, err := sitePassword(keys, site)
+		if err != nil {
+			fmt.Printf("password generation error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		result := "differs, change it at the site to the one mpw derives"
+		if password == entry.Password {
+			result = "derived by mpw"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", site.Name, entry.Title, result)
+	}
+	w.Flush()
+	err = writeSites(sites)
+	if err != nil {
+		fmt.Printf("error writing sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("Imported %d entries\n", len(imported))
+}
+
+// importedSiteName is the site name of entry, the host name of its URL or
+// else its title. imported maps the sites stored by earlier entries of the
+// import to their logins. A site holds a single login, so an entry for one
+// of them with another login is stored as login@site.
+func importedSiteName(entry mpw.VaultEntry, imported map[string]string) (string, error) {
+	name := strings.TrimSpace(entry.Title)
+	if entry.URL != "" {
+		if host, err := mpw.CanonicalSiteName(entry.URL); err == nil {
+			name = host
+		}
+	}
+	if name == "" {
+		return "", errors.New("no title or URL")
+	}
+	login, found := imported[name]
+	if !found {
+		return name, nil
+	}
+	if login != entry.UserName && entry.UserName != "" {
+		name = entry.UserName + "@" + name
+		if _, found := imported[name]; !found {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("%s: an earlier entry was imported as %s", entry.Title, name)
+}
+
+// importEntry adds what entry describes to site. What the site already
+// stores is kept, and so are its password parameters.
+func importEntry(site mpw.Site, name string, entry mpw.VaultEntry) mpw.Site {
+	site.Name = name
+	if site.Login == "" {
+		site.Login = entry.UserName
+	}
+	if site.URL == "" {
+		site.URL = entry.URL
+	}
+	if site.Notes == "" {
+		site.Notes = entry.Notes
+	}
+	if len(site.Tags) == 0 {
+		site.Tags = entry.Tags
+	}
+	return site
+}
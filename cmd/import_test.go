@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+func TestImportedSiteName(t *testing.T) {
+	imported := map[string]string{}
+	for _, test := range []struct {
+		entry mpw.VaultEntry
+		name  string
+	}{
+		{mpw.VaultEntry{Title: "GitHub", URL: "https://www.github.com/login", UserName: "rob"}, "github.com"},
+		{mpw.VaultEntry{Title: "GitHub work", URL: "https://github.com", UserName: "robert"}, "robert@github.com"},
+		{mpw.VaultEntry{Title: " Bank "}, "Bank"},
+		{mpw.VaultEntry{Title: "Router", URL: "not a url"}, "Router"},
+	} {
+		name, err := importedSiteName(test.entry, imported)
+		require.NoError(t, err)
+		require.Equal(t, test.name, name)
+		imported[name] = test.entry.UserName
+	}
+	for _, entry := range []mpw.VaultEntry{
+		{},
+		{Title: "GitHub again", URL: "https://github.com", UserName: "rob"},
+		{Title: "GitHub work again", URL: "https://github.com", UserName: "robert"},
+		{Title: "GitHub without login", URL: "https://github.com"},
+	} {
+		_, err := importedSiteName(entry, imported)
+		require.Error(t, err, entry.Title)
+	}
+}
+
+func TestImportEntry(t *testing.T) {
+	entry := mpw.VaultEntry{
+		Title:    "GitHub",
+		URL:      "https://github.com",
+		UserName: "rob",
+		Notes:    "work account",
+		Tags:     []string{"work"},
+	}
+	site := importEntry(mpw.Site{}, "github.com", entry)
+	require.Equal(t, mpw.Site{Name: "github.com", Login: "rob", URL: "https://github.com", Notes: "work account", Tags: []string{"work"}}, site)
+
+	stored := mpw.Site{Name: "github.com", Counter: 3, Login: "robert", Notes: "personal"}
+	site = importEntry(stored, "github.com", entry)
+	require.Equal(t, mpw.Site{Name: "github.com", Counter: 3, Login: "robert", URL: "https://github.com", Notes: "personal", Tags: []string{"work"}}, site)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// maxInitAttempts is how often a too weak or mistyped master password may
+// be entered again.
+const maxInitAttempts = 3
+
+// initProfile creates the profile in the config: the full name, and a
+// master password that is checked for strength before it is used.
+func initProfile(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	fullName := fs.String("full-name", "", "Full name of the user, defaults to the one in the config")
+	verbose := fs.Bool("v", false, "Show the parts the master password would be guessed as")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Println("usage: mpw init [--full-name NAME] [-v]")
+		os.Exit(1)
+	}
+	config, err := readConfig()
+	if err != nil {
+		fmt.Printf("error reading config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if *fullName == "" {
+		*fullName = config.FullName
+	}
+	if *fullName == "" {
+		*fullName, err = input("Full Name: ")
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+	if strings.TrimSpace(*fullName) == "" {
+		fmt.Println("full name missing")
+		os.Exit(1)
+	}
+
+	var masterPassword string
+	for attempt := 1; ; attempt++ {
+		masterPassword, err = newMasterPassword(*fullName, config.MinScore, *verbose)
+		if err == nil {
+			break
+		}
+		fmt.Println(err.Error())
+		if attempt == maxInitAttempts {
+			os.Exit(1)
+		}
+	}
+	masterKey, err := mpw.MasterKey(*fullName, masterPassword)
+	if err != nil {
+		fmt.Printf("error deriving master key: %s\n", err.Error())
+		os.Exit(1)
+	}
+	config.FullName = *fullName
+	err = writeConfig(config)
+	if err != nil {
+		fmt.Printf("error writing config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("Identicon: %s\n", mpw.Identicon(*fullName, masterPassword, false))
+	fmt.Printf("Key ID: %s\n", mpw.KeyID(masterKey))
+}
+
+// newMasterPassword asks for a master password, reports its strength and
+// has it repeated once it is strong enough.
+func newMasterPassword(fullName string, minScore int, verbose bool) (string, error) {
+	masterPassword, err := askSecret("New Master Password: ")
+	if err != nil {
+		return "", err
+	}
+	strength := mpw.EstimateStrength(masterPassword, []string{fullName})
+	fmt.Printf("Strength: %d/4, %.1e guesses\n", strength.Score, strength.Guesses)
+	fmt.Printf("Cracking time: %s at %d guesses per second\n",
+		humanDuration(strength.Guesses/mpw.MasterKeyGuessesPerSecond), mpw.MasterKeyGuessesPerSecond)
+	if verbose {
+		for _, match := range strength.Sequence {
+			pattern := match.Pattern
+			if match.Dictionary != "" {
+				pattern += " " + match.Dictionary
+			}
+			if match.Graph != "" {
+				pattern += " " + match.Graph
+			}
+			fmt.Printf("  %-24q %-22s %.1e guesses\n", match.Token, pattern, match.Guesses)
+		}
+	}
+	if strength.Score < minScore {
+		return "", fmt.Errorf("master password too weak, MIN_SCORE is %d", minScore)
+	}
+	repeated, err := askSecret("Repeat Master Password: ")
+	if err != nil {
+		return "", err
+	}
+	if repeated != masterPassword {
+		return "", errors.New("master passwords do not match")
+	}
+	return masterPassword, nil
+}
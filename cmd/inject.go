@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// inject renders a text/template with derived secrets, e.g.
+//
+//	user = {{ mpwLogin "db.example" }}
+//	password = {{ mpw "db.example" "counter=2" }}
+//	secret = {{ mpwKey "tls" 256 "hex" }}
+//
+// The master key is derived once, when the first placeholder needs it.
+func inject(args []string) {
+	fs := flag.NewFlagSet("inject", flag.ExitOnError)
+	inputPath := fs.String("i", "", "Template to render")
+	outputPath := fs.String("o", "", "File to write, stdout if not given")
+	force := fs.Bool("force", false, "Overwrite the output file if it exists")
+	fs.Parse(args)
+	if *inputPath == "" || fs.NArg() != 0 {
+		fmt.Println("usage: mpw inject -i TEMPLATE [-o OUTPUT] [--force]")
+		os.Exit(1)
+	}
+	if *outputPath != "" && !*force {
+		if _, err := os.Lstat(*outputPath); err == nil {
+			fmt.Printf("%s exists, use --force to overwrite it\n", *outputPath)
+			os.Exit(1)
+		}
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	derive := func(fields []string) (string, error) {
+		spec, err := parseSiteSpec(fields, sites)
+		if err != nil {
+			return "", err
+		}
+		keys, err := unlockMasterKeys()
+		if err != nil {
+			return "", err
+		}
+		return spec.derive(keys)
+	}
+	tmpl, err := template.New(filepath.Base(*inputPath)).Funcs(template.FuncMap{
+		"mpw": func(site string, options ...string) (string, error) {
+			return derive(append([]string{site}, options...))
+		},
+		"mpwLogin": func(site string, options ...string) (string, error) {
+			return derive(append([]string{site, "purpose=Identification"}, options...))
+		},
+		"mpwKey": func(name string, bits int, encoding string) (string, error) {
+			if bits%8 != 0 {
+				return "", fmt.Errorf("key size %d is not a whole number of bytes", bits)
+			}
+			key, err := unlockMasterKey()
+			if err != nil {
+				return "", err
+			}
+			derived, err := mpw.DerivedKey(key, mpw.KeyScope, name, 1, bits/8)
+			if err != nil {
+				return "", err
+			}
+			switch encoding {
+			case "hex":
+				return hex.EncodeToString(derived), nil
+			case "base64":
+				return base64.StdEncoding.EncodeToString(derived), nil
+			case "base64url":
+				return base64.RawURLEncoding.EncodeToString(derived), nil
+			}
+			return "", fmt.Errorf("unknown key encoding %q, use hex, base64 or base64url", encoding)
+		},
+	}).ParseFiles(*inputPath)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	var rendered bytes.Buffer
+	err = tmpl.Execute(&rendered, nil)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if *outputPath == "" {
+		os.Stdout.Write(rendered.Bytes())
+		return
+	}
+	err = mpw.WriteFileAtomic(*outputPath, rendered.Bytes(), *force)
+	if err != nil {
+		fmt.Printf("error writing %s: %s\n", *outputPath, err.Error())
+		os.Exit(1)
+	}
+}
@@ -3,17 +3,74 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 
 	mpw "github.com/emiljoha/mpw-go/internal"
 	"golang.org/x/term"
 )
 
+var commands map[string]func(args []string)
+
+// personalities are the commands run when the binary is installed under
+// another name, as git and docker expect of their credential helpers.
+var personalities = map[string]string{
+	"git-credential-mpw":    "git-credential",
+	"docker-credential-mpw": "docker-credential",
+}
+
+func init() {
+	commands = map[string]func(args []string){
+		"annotate":          annotate,
+		"audit":             audit,
+		"completion":        completion,
+		"docker-credential": dockerCredentialCommand,
+		"due":               due,
+		"encrypt-sites":     encryptSites,
+		"explain":           explain,
+		"export":            export,
+		"git-credential":    gitCredential,
+		"identify":          identify,
+		"import":            importVault,
+		"init":              initProfile,
+		"inject":            inject,
+		"menu":              menu,
+		"merge-sites":       mergeSites,
+		"migrate-master":    migrateMaster,
+		"native-host":       nativeHostCommand,
+		"policy":            policy,
+		"print-sheet":       printSheet,
+		"rotate":            rotate,
+		"run":               run,
+		"show":              show,
+		"ssh-agent":         sshAgent,
+		"ssh-pubkey":        sshPubkey,
+		"sync":              syncSites,
+		"types":             types,
+		"upgrade":           upgrade,
+		"wireguard":         wireguard,
+		"__complete":        complete,
+	}
+}
+
 func main() {
-	flags := parseFlags()
+	if command, found := personalities[filepath.Base(os.Args[0])]; found {
+		commands[command](os.Args[1:])
+		return
+	}
+	if len(os.Args) > 1 {
+		if command, found := commands[os.Args[1]]; found {
+			command(os.Args[2:])
+			return
+		}
+	}
+	flags := parseFlags(flag.CommandLine, os.Args[1:])
 	config, err := readConfig()
 	if err != nil {
 		fmt.Printf("error reading config: %s\n", err.Error())
@@ -31,46 +88,109 @@ func main() {
 			flags.FullName = fullName
 		}
 	}
+	unlockFullName = flags.FullName
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if flags.SiteName == "" && term.IsTerminal(int(os.Stdin.Fd())) {
+		history, err := readHistory()
+		if err != nil {
+			fmt.Printf("error reading history: %s\n", err.Error())
+			os.Exit(1)
+		}
+		site, bumped, err := pickSite(sites, history)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if bumped {
+			original, found := mpw.FindSite(sites, site.Name)
+			if !found {
+				original = mpw.Site{Name: site.Name}
+			}
+			sites = mpw.PutSite(sites, mpw.RotateSite(original, site.Counter, time.Now()))
+			err = writeSites(sites)
+			if err != nil {
+				fmt.Printf("error writing sites: %s\n", err.Error())
+				os.Exit(1)
+			}
+		}
+		flags.SiteName = site.Name
+	}
 	if flags.SiteName == "" {
-		siteName, err := input("Site Name: ")
+		siteName, err := input(pickerPrompt)
 		if err != nil {
 			fmt.Println(err.Error())
 			os.Exit(1)
 		}
 		flags.SiteName = siteName
 	}
-	_, ok := mpw.TemplateDictionary[flags.SiteResultType]
-	if !ok {
-		typeAbbreviations := map[mpw.ResultType]mpw.ResultType{
-			"x": "Maximum",
-			"l": "Long",
-			"m": "Medium",
-			"b": "Basic",
-			"s": "Short",
-			"i": "PIN",
-			"n": "Name",
-			"p": "Phrase",
-		}
-		fullSiteResult, ok := typeAbbreviations[flags.SiteResultType]
-		if !ok {
-			fmt.Printf("Site result type not valid: %s\n", flags.SiteResultType)
-			os.Exit(1)
+	site, found := mpw.FindSite(sites, flags.SiteName)
+	if found {
+		if !flags.CounterSet {
+			flags.Counter = siteCounter(site)
+		}
+		if !flags.SiteResultTypeSet {
+			flags.SiteResultType = siteType(site)
 		}
-		flags.SiteResultType = mpw.ResultType(fullSiteResult)
 	}
-	fmt.Print("Password: ")
-	pass, err := term.ReadPassword(int(os.Stdin.Fd()))
-	fmt.Print("\n")
+	flags.SiteResultType, err = resolveResultType(flags.SiteResultType)
 	if err != nil {
-		fmt.Printf("password input error: %s\n", err.Error())
-		os.Exit(1)		
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	// An encrypted sites store has asked for the master password already.
+	var pass []byte
+	if askedMasterPassword != nil {
+		pass = []byte(*askedMasterPassword)
+	} else {
+		fmt.Print("Password: ")
+		pass, err = term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Print("\n")
+		if err != nil {
+			fmt.Printf("password input error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	var result string
+	if flags.SiteResultType == mpw.Words {
+		options := flags.Passphrase
+		if site.Passphrase != nil {
+			options = mergePassphraseOptions(*site.Passphrase, flags.Passphrase)
+		}
+		var masterKey []byte
+		masterKey, err = mpw.MasterKey(flags.FullName, string(pass))
+		if err == nil {
+			result, err = mpw.SitePassphrase(masterKey, flags.SiteName, flags.Counter, mpw.Authentication, "", options)
+		}
+		if flags.Verbose {
+			fmt.Printf("Entropy: %.1f bits\n", options.Entropy())
+		}
+	} else {
+		algorithm := siteAlgorithm(site)
+		var masterKey []byte
+		masterKey, err = mpw.MasterKeyForAlgorithm(algorithm, flags.FullName, string(pass))
+		if err == nil {
+			result, err = mpw.SiteResultForAlgorithm(algorithm, masterKey, flags.SiteName, flags.Counter, mpw.Authentication, "", flags.SiteResultType)
+		}
 	}
-	sitePassword, err :=mpw.Password(flags.FullName, string(pass), flags.SiteName, flags.Counter, flags.SiteResultType)
 	if err != nil {
 		fmt.Printf("password generation error: %s\n", err.Error())
 		os.Exit(1)
 	}
-	fmt.Println(sitePassword)
+	err = addHistory(flags.SiteName)
+	if err != nil {
+		fmt.Printf("error updating history: %s\n", err.Error())
+	}
+	if found && flags.Counter == siteCounter(site) {
+		err = recordUse(site.Name)
+		if err != nil {
+			fmt.Printf("error updating sites: %s\n", err.Error())
+		}
+	}
+	fmt.Println(result)
 }
 
 func input(prompt string) (string, error) {
@@ -83,12 +203,259 @@ func input(prompt string) (string, error) {
 	return strings.TrimSuffix(input, "\n"), nil
 }
 
+// askedMasterPassword is the master password once it was asked for, so
+// that an encrypted sites store and the command share it.
+var askedMasterPassword *string
+
+// askMasterPassword reads the master password for commands whose stdin is
+// used by their caller. The program in MPW_ASKPASS is asked if set, like
+// SSH_ASKPASS, otherwise the password is read from the terminal. It is
+// only asked once per invocation.
+func askMasterPassword() (string, error) {
+	if askedMasterPassword != nil {
+		return *askedMasterPassword, nil
+	}
+	masterPassword, err := askSecret("Master Password: ")
+	if err != nil {
+		return "", err
+	}
+	askedMasterPassword = &masterPassword
+	return masterPassword, nil
+}
+
+// askSecret reads a secret the way askMasterPassword does.
+func askSecret(prompt string) (string, error) {
+	if askpass := os.Getenv("MPW_ASKPASS"); askpass != "" {
+		cmd := exec.Command(askpass, prompt)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", askpass, err)
+		}
+		return strings.TrimSuffix(string(out), "\n"), nil
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("no terminal to read the master password from, set MPW_ASKPASS: %w", err)
+	}
+	defer tty.Close()
+	fmt.Fprint(tty, prompt)
+	pass, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprint(tty, "\n")
+	if err != nil {
+		return "", err
+	}
+	return string(pass), nil
+}
+
+// unlockedMasterKeys are the master keys once unlockMasterKeys derived
+// them.
+var unlockedMasterKeys [][]byte
+
+// unlockFullName is the full name unlockMasterKeys derives the master keys
+// for, if given on the command line.
+var unlockFullName string
+
+// unlockMasterKeys derives the master keys of every algorithm version of
+// the user, unlockFullName or else the one in the config.
+func unlockMasterKeys() ([][]byte, error) {
+	if unlockedMasterKeys != nil {
+		return unlockedMasterKeys, nil
+	}
+	fullName := unlockFullName
+	if fullName == "" {
+		config, err := readConfig()
+		if err != nil {
+			return nil, err
+		}
+		if config.FullName == "" {
+			return nil, errors.New("FULL_NAME missing in the config")
+		}
+		fullName = config.FullName
+	}
+	masterPassword, err := askMasterPassword()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := mpw.MasterKeys(fullName, masterPassword)
+	if err != nil {
+		return nil, err
+	}
+	unlockedMasterKeys = keys
+	return keys, nil
+}
+
+// unlockMasterKey derives the master key of the current algorithm version
+// like unlockMasterKeys.
+func unlockMasterKey() ([]byte, error) {
+	keys, err := unlockMasterKeys()
+	if err != nil {
+		return nil, err
+	}
+	return keys[mpw.CurrentAlgorithm], nil
+}
+
+var typeAbbreviations = map[mpw.ResultType]mpw.ResultType{
+	"x": "Maximum",
+	"l": "Long",
+	"m": "Medium",
+	"b": "Basic",
+	"s": "Short",
+	"i": "PIN",
+	"n": "Name",
+	"p": "Phrase",
+	"w": "Words",
+}
+
+// resolveResultType expands the one letter abbreviations of the result
+// types.
+func resolveResultType(resultType mpw.ResultType) (mpw.ResultType, error) {
+	if _, ok := mpw.TemplateDictionary[resultType]; ok || resultType == mpw.Words {
+		return resultType, nil
+	}
+	fullSiteResult, ok := typeAbbreviations[resultType]
+	if !ok {
+		return "", fmt.Errorf("Site result type not valid: %s", resultType)
+	}
+	return fullSiteResult, nil
+}
+
+// sitePassword derives the password of site with its stored parameters,
+// from the master key of its algorithm version in keys.
+func sitePassword(keys [][]byte, site mpw.Site) (string, error) {
+	algorithm := siteAlgorithm(site)
+	if algorithm < 0 || algorithm >= len(keys) {
+		return "", fmt.Errorf("%s: algorithm version %d not found", site.Name, algorithm)
+	}
+	resultType, err := resolveResultType(siteType(site))
+	if err != nil {
+		return "", err
+	}
+	if resultType == mpw.Words && site.Passphrase != nil {
+		return mpw.SitePassphrase(keys[mpw.CurrentAlgorithm], site.Name, siteCounter(site), mpw.Authentication, "", *site.Passphrase)
+	}
+	return mpw.SiteResultForAlgorithm(algorithm, keys[algorithm], site.Name, siteCounter(site), mpw.Authentication, "", resultType)
+}
+
+// mergePassphraseOptions overrides the stored options with those given.
+func mergePassphraseOptions(stored, given mpw.PassphraseOptions) mpw.PassphraseOptions {
+	if given.Words != 0 {
+		stored.Words = given.Words
+	}
+	if given.Separator != nil {
+		stored.Separator = given.Separator
+	}
+	if given.Capitalization != "" {
+		stored.Capitalization = given.Capitalization
+	}
+	return stored
+}
+
+// loginName is the login stored for site, or else the login name derived
+// for it. Login names are always derived with the initial counter.
+func loginName(masterKey []byte, site mpw.Site) (string, error) {
+	if site.Login != "" {
+		return site.Login, nil
+	}
+	return mpw.SiteResult(masterKey, site.Name, 1, mpw.Identification, "", "Name")
+}
+
 type Config struct {
 	FullName string `json:"FULL_NAME"`
+	SSHKeys []string `json:"SSH_KEYS,omitempty"`
+	// WireGuardKeys are the sites WireGuard keys are derived for, listed
+	// on recovery sheets with SSHKeys.
+	WireGuardKeys []string `json:"WIREGUARD_KEYS,omitempty"`
+	// MinScore is the strength score from 0 to 4 that new master passwords
+	// must reach.
+	MinScore int `json:"MIN_SCORE,omitempty"`
+}
+
+func configDir() string {
+	return os.Getenv("HOME") + "/.config/mpw"
+}
+
+func sitesPath() string {
+	return configDir() + "/sites.json"
+}
+
+// readSites reads the sites store, unlocking the master key if the store
+// is encrypted.
+func readSites() ([]mpw.Site, error) {
+	return readSitesFile(sitesPath())
+}
+
+// readSitesFile reads a sites store at path like readSites.
+func readSitesFile(path string) ([]mpw.Site, error) {
+	sites, err := mpw.ReadSites(path)
+	if !errors.Is(err, mpw.ErrSitesEncrypted) {
+		return sites, err
+	}
+	masterKey, err := unlockMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	return mpw.ReadEncryptedSites(path, masterKey)
+}
+
+// writeSites writes the sites store, encrypted if it is encrypted. The
+// sites that changed are marked modified for merging.
+func writeSites(sites []mpw.Site) error {
+	previous, err := readSites()
+	if err != nil {
+		return err
+	}
+	sites = mpw.TouchSites(previous, sites, time.Now())
+	if !sitesEncrypted() {
+		return mpw.WriteSites(sitesPath(), sites)
+	}
+	masterKey, err := unlockMasterKey()
+	if err != nil {
+		return err
+	}
+	return mpw.WriteEncryptedSites(sitesPath(), masterKey, sites)
+}
+
+func sitesEncrypted() bool {
+	b, err := os.ReadFile(sitesPath())
+	return err == nil && mpw.Encrypted(b)
+}
+
+func historyPath() string {
+	return configDir() + "/history"
+}
+
+// historyKey is the master key the history is encrypted under, nil unless
+// the sites store is encrypted.
+func historyKey() ([]byte, error) {
+	if !sitesEncrypted() {
+		return nil, nil
+	}
+	return unlockMasterKey()
+}
+
+// readHistory reads the history, unlocking the master key if the sites
+// store is encrypted.
+func readHistory() ([]string, error) {
+	masterKey, err := historyKey()
+	if err != nil {
+		return nil, err
+	}
+	return mpw.ReadEncryptedHistory(historyPath(), masterKey)
+}
+
+// addHistory moves siteName to the front of the history, encrypted if the
+// sites store is encrypted.
+func addHistory(siteName string) error {
+	masterKey, err := historyKey()
+	if err != nil {
+		return err
+	}
+	return mpw.AddEncryptedHistory(historyPath(), masterKey, siteName)
 }
 
 func readConfig() (Config, error) {
-	b, err := os.ReadFile(os.Getenv("HOME") + "/.config/mpw/config.json")
+	b, err := os.ReadFile(configDir() + "/config.json")
 	if err != nil {
 		return Config{}, nil
 	}
@@ -100,19 +467,36 @@ func readConfig() (Config, error) {
 	return c, nil
 }
 
+func writeConfig(c Config) error {
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(configDir(), 0700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(configDir()+"/config.json", append(b, '\n'), 0600)
+}
+
 type Flags struct {
 	FullName string
 	Counter int
 	SiteResultType mpw.ResultType
+	// CounterSet and SiteResultTypeSet are whether the counter and the type
+	// were given, those given win over the ones stored for the site.
+	CounterSet bool
+	SiteResultTypeSet bool
 	Verbose bool
 	Quiet bool
 	SiteName string
+	Passphrase mpw.PassphraseOptions
 }
-func parseFlags() Flags {
-	fullName := flag.String("full-name", "","Specify the full name of the user")
-	fullNameShorthand := flag.String("u", "","Specify the full name of the user")
-	counter := flag.Int("counter", 1,"Specify the full name of the user")
-	counterShorthand := flag.Int("c", 1,"Specify the full name of the user")
+func parseFlags(fs *flag.FlagSet, arguments []string) Flags {
+	fullName := fs.String("full-name", "","Specify the full name of the user")
+	fullNameShorthand := fs.String("u", "","Specify the full name of the user")
+	counter := fs.Int("counter", 1,"Specify the full name of the user")
+	counterShorthand := fs.Int("c", 1,"Specify the full name of the user")
 	helpSiteResultType := "Specify the password's template\n"+
          "Defaults to 'long' (-t a)\n"+
          "x, Maximum  | 20 characters, contains symbols.\n"+
@@ -122,32 +506,43 @@ func parseFlags() Flags {
          "s, Short    | Copy-friendly, 4 characters, no symbols.\n"+
          "i, Pin      | 4 numbers.\n"+
          "n, Name     | 9 letter name.\n"+
-         "p, Phrase   | 20 character sentence."
-	siteResultType := flag.String("site-result-type", "Long", helpSiteResultType)
-	siteResultTypeShortHand := flag.String("t", "Long", helpSiteResultType)
-	verbose := flag.Bool("verbose", false, "Increase output verbosity")
-	verboseShortHand := flag.Bool("v", false, "Increase output verbosity")
-	quiet := flag.Bool("quiet", false, "Decrease output verbosity")
-	quietShortHand := flag.Bool("q", false, "Decrease output verbosity")
+         "p, Phrase   | 20 character sentence.\n"+
+         "w, Words    | 6 word passphrase, see -words."
+	siteResultType := fs.String("site-result-type", "Long", helpSiteResultType)
+	siteResultTypeShortHand := fs.String("t", "Long", helpSiteResultType)
+	verbose := fs.Bool("verbose", false, "Increase output verbosity")
+	verboseShortHand := fs.Bool("v", false, "Increase output verbosity")
+	quiet := fs.Bool("quiet", false, "Decrease output verbosity")
+	quietShortHand := fs.Bool("q", false, "Decrease output verbosity")
+	words := fs.Int("words", 0, "Number of words in Words passphrases, defaults to 6")
+	separator := fs.String("separator", "", "Separator between the words of Words passphrases, defaults to a space")
+	capitalize := fs.String("capitalize", "", "Capitalization of Words passphrases: lower, title or upper, defaults to lower")
 
-	flag.Parse()
+	fs.Parse(arguments)
 
 	if *fullNameShorthand != "" {
 		fullName = fullNameShorthand
 	}
-	if *counterShorthand != 1 {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["c"] {
 		counter = counterShorthand
 	}
-	if *siteResultTypeShortHand != "Long" {
+	if set["t"] {
 		siteResultType = siteResultTypeShortHand
 	}
+	// An empty separator given joins the words.
+	var separatorOption *string
+	if set["separator"] {
+		separatorOption = separator
+	}
 	if *verboseShortHand {
 		verbose = verboseShortHand
 	}
 	if *quietShortHand {
 		quiet = quietShortHand
 	}
-	args := flag.Args()
+	args := fs.Args()
 	if len(args) > 1 {
 		_, _ = fmt.Printf("only one non-flagged comman line argument allowed: %s", args)
 		os.Exit(1)
@@ -166,8 +561,15 @@ func parseFlags() Flags {
 		FullName: *fullName,
 		Counter: *counter,
 		SiteResultType: mpw.ResultType(*siteResultType),
+		CounterSet: set["counter"] || set["c"],
+		SiteResultTypeSet: set["site-result-type"] || set["t"],
 		Verbose: *verbose,
 		Quiet: *quiet,
 		SiteName: siteName,		
+		Passphrase: mpw.PassphraseOptions{
+			Words: *words,
+			Separator: separatorOption,
+			Capitalization: mpw.Capitalization(*capitalize),
+		},
 	}
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+func TestSitePasswordAlgorithm(t *testing.T) {
+	// The full name is counted in characters before version 3, so its
+	// master keys differ from those of the current version.
+	fullName, masterPassword := "Zoë Ångström", "banana colored duckling"
+	keys, err := mpw.MasterKeys(fullName, masterPassword)
+	require.NoError(t, err)
+	require.NotEqual(t, keys[1], keys[mpw.CurrentAlgorithm])
+
+	algorithm := 1
+	site := mpw.Site{Name: "masterpasswordapp.com", Counter: 2, Algorithm: &algorithm}
+	key, err := mpw.MasterKeyForAlgorithm(algorithm, fullName, masterPassword)
+	require.NoError(t, err)
+	expected, err := mpw.SiteResultForAlgorithm(algorithm, key, site.Name, 2, mpw.Authentication, "", "Long")
+	require.NoError(t, err)
+	withCurrentKey, err := mpw.SiteResultForAlgorithm(algorithm, keys[mpw.CurrentAlgorithm], site.Name, 2, mpw.Authentication, "", "Long")
+	require.NoError(t, err)
+	require.NotEqual(t, expected, withCurrentKey)
+
+	password, err := sitePassword(keys, site)
+	require.NoError(t, err)
+	require.Equal(t, expected, password)
+
+	spec, err := parseSiteSpec([]string{site.Name}, []mpw.Site{site})
+	require.NoError(t, err)
+	password, err = spec.derive(keys)
+	require.NoError(t, err)
+	require.Equal(t, expected, password)
+
+	algorithm = mpw.CurrentAlgorithm + 1
+	_, err = sitePassword(keys, site)
+	require.Error(t, err)
+}
+
+func TestParseFlagsExplicit(t *testing.T) {
+	flags := parseFlags(flag.NewFlagSet("mpw", flag.ContinueOnError), []string{"github.com"})
+	require.False(t, flags.CounterSet)
+	require.False(t, flags.SiteResultTypeSet)
+
+	flags = parseFlags(flag.NewFlagSet("mpw", flag.ContinueOnError), []string{"-c", "1", "-t", "Long", "github.com"})
+	require.True(t, flags.CounterSet)
+	require.True(t, flags.SiteResultTypeSet)
+	require.Equal(t, 1, flags.Counter)
+	require.Equal(t, mpw.ResultType("Long"), flags.SiteResultType)
+
+	flags = parseFlags(flag.NewFlagSet("mpw", flag.ContinueOnError), []string{"--counter", "3", "github.com"})
+	require.True(t, flags.CounterSet)
+	require.Equal(t, 3, flags.Counter)
+}
+
+func TestUnlockMasterKeysFullName(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	require.NoError(t, writeConfig(Config{FullName: "Robert Lee Mitchell"}))
+	masterPassword := "banana colored duckling"
+	askedMasterPassword = &masterPassword
+	unlockFullName = "Zoë Ångström"
+	defer func() {
+		askedMasterPassword = nil
+		unlockFullName = ""
+		unlockedMasterKeys = nil
+	}()
+
+	keys, err := unlockMasterKeys()
+	require.NoError(t, err)
+	expected, err := mpw.MasterKeys("Zoë Ångström", masterPassword)
+	require.NoError(t, err)
+	require.Equal(t, expected, keys)
+}
+
+func TestParseFlagsSeparator(t *testing.T) {
+	flags := parseFlags(flag.NewFlagSet("mpw", flag.ContinueOnError), []string{"-t", "w", "github.com"})
+	require.Nil(t, flags.Passphrase.Separator)
+
+	flags = parseFlags(flag.NewFlagSet("mpw", flag.ContinueOnError), []string{"-t", "w", "--separator", "", "github.com"})
+	require.NotNil(t, flags.Passphrase.Separator)
+	require.Equal(t, "", *flags.Passphrase.Separator)
+}
+
+func TestSpecPassphrase(t *testing.T) {
+	keys, err := mpw.MasterKeys("Robert Lee Mitchell", "banana colored duckling")
+	require.NoError(t, err)
+	separator := "-"
+	options := mpw.PassphraseOptions{Words: 4, Separator: &separator, Capitalization: mpw.Titlecase}
+	site := mpw.Site{Name: "masterpasswordapp.com", Type: mpw.Words, Passphrase: &options}
+	expected, err := mpw.SitePassphrase(keys[mpw.CurrentAlgorithm], site.Name, 1, mpw.Authentication, "", options)
+	require.NoError(t, err)
+
+	spec, err := parseSiteSpec([]string{site.Name}, []mpw.Site{site})
+	require.NoError(t, err)
+	password, err := spec.derive(keys)
+	require.NoError(t, err)
+	require.Equal(t, expected, password)
+
+	spec, err = parseSiteSpec([]string{site.Name, "counter=2"}, []mpw.Site{site})
+	require.NoError(t, err)
+	password, err = spec.derive(keys)
+	require.NoError(t, err)
+	site.Counter = 2
+	expected, err = sitePassword(keys, site)
+	require.NoError(t, err)
+	require.Equal(t, expected, password)
+}
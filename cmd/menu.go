@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// passwordLaunchers reads the master password with the password mode of
+// the dmenu compatible launchers that have one. dmenu itself has none, its
+// input is hidden by drawing it in the background color.
+var passwordLaunchers = map[string][]string{
+	"dmenu":  {"dmenu", "-p", "Master Password:", "-nf", "#222222", "-nb", "#222222"},
+	"rofi":   {"rofi", "-dmenu", "-password", "-p", "Master Password"},
+	"fuzzel": {"fuzzel", "--dmenu", "--password", "--prompt", "Master Password: "},
+	"wofi":   {"wofi", "--dmenu", "--password", "--prompt", "Master Password"},
+}
+
+// menu picks the site with a dmenu compatible launcher, reads the master
+// password graphically and copies or types the password, so that it can be
+// bound to a key in the desktop environment.
+func menu(args []string) {
+	fs := flag.NewFlagSet("menu", flag.ExitOnError)
+	launcher := fs.String("launcher", "dmenu", "dmenu compatible command picking the site, e.g. 'rofi -dmenu'")
+	passwordLauncher := fs.String("password-launcher", "", "Command reading the master password, defaults to the password mode of the launcher")
+	fullName := fs.String("full-name", "", "Specify the full name of the user")
+	typeResult := fs.Bool("type", false, "Type the password with wtype instead of copying it with wl-copy")
+	login := fs.Bool("login", false, "Copy or type the login name instead of the password")
+	fs.Parse(args)
+	launcherCommand := strings.Fields(*launcher)
+	if fs.NArg() != 0 || len(launcherCommand) == 0 {
+		fmt.Println("usage: mpw menu [--launcher CMD] [--password-launcher CMD] [--full-name NAME] [--type] [--login]")
+		os.Exit(1)
+	}
+
+	config, err := readConfig()
+	if err != nil {
+		fmt.Printf("error reading config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if *fullName == "" {
+		*fullName = config.FullName
+	}
+	if *fullName == "" {
+		fmt.Println("full name missing, use --full-name or FULL_NAME in the config")
+		os.Exit(1)
+	}
+	passwordCommand := strings.Fields(*passwordLauncher)
+	if len(passwordCommand) == 0 {
+		program := filepath.Base(launcherCommand[0])
+		var found bool
+		passwordCommand, found = passwordLaunchers[program]
+		if !found {
+			fmt.Printf("no password mode known for %s, use --password-launcher\n", program)
+			os.Exit(1)
+		}
+	}
+	unlockFullName = *fullName
+	// masterKey is set if the sites store, and so the history, is
+	// encrypted.
+	var masterKey []byte
+	sites, err := mpw.ReadSites(sitesPath())
+	if errors.Is(err, mpw.ErrSitesEncrypted) {
+		// The site names are encrypted too, so the master password is
+		// read before the site is picked.
+		err = askLauncherPassword(passwordCommand)
+		if err == nil {
+			masterKey, err = unlockMasterKey()
+		}
+		if err == nil {
+			sites, err = mpw.ReadEncryptedSites(sitesPath(), masterKey)
+		}
+	}
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	history, _ := mpw.ReadEncryptedHistory(historyPath(), masterKey)
+	names := candidateNames(sites, history)
+	siteName, err := runLauncher(launcherCommand, strings.Join(names, "\n")+"\n")
+	if err != nil {
+		fmt.Printf("site selection error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if siteName == "" {
+		fmt.Println("no site selected")
+		os.Exit(1)
+	}
+	if askedMasterPassword == nil {
+		err = askLauncherPassword(passwordCommand)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+	keys, err := unlockMasterKeys()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	site, found := mpw.FindSite(sites, siteName)
+	if !found {
+		site = mpw.Site{Name: siteName}
+	}
+	var result string
+	if *login {
+		result, err = loginName(keys[mpw.CurrentAlgorithm], site)
+	} else {
+		result, err = sitePassword(keys, site)
+	}
+	if err != nil {
+		fmt.Printf("password generation error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	err = mpw.AddEncryptedHistory(historyPath(), masterKey, site.Name)
+	if err != nil {
+		fmt.Printf("error updating history: %s\n", err.Error())
+	}
+	output := exec.Command("wl-copy")
+	if *typeResult {
+		output = exec.Command("wtype", "-")
+	}
+	output.Stdin = strings.NewReader(result)
+	output.Stderr = os.Stderr
+	err = output.Run()
+	if err != nil {
+		fmt.Printf("error running %s: %s\n", output.Path, err.Error())
+		os.Exit(1)
+	}
+}
+
+// askLauncherPassword reads the master password with the password mode of
+// a launcher, for unlockMasterKeys.
+func askLauncherPassword(command []string) error {
+	masterPassword, err := runLauncher(command, "")
+	if err != nil {
+		return fmt.Errorf("password input error: %w", err)
+	}
+	askedMasterPassword = &masterPassword
+	return nil
+}
+
+// runLauncher runs a dmenu compatible command with the choices in input and
+// returns the line it printed.
+func runLauncher(command []string, input string) (string, error) {
+	if len(command) == 0 {
+		return "", errors.New("no launcher command")
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stderr = os.Stderr
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+func TestMenuAlgorithm(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	bin := t.TempDir()
+	copied := filepath.Join(bin, "copied")
+	for name, script := range map[string]string{
+		"launcher":          "cat >/dev/null\necho masterpasswordapp.com\n",
+		"password-launcher": "echo 'banana colored duckling'\n",
+		"wl-copy":           "cat >" + copied + "\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"+script), 0700))
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	defer func() {
+		askedMasterPassword = nil
+		unlockFullName = ""
+		unlockedMasterKeys = nil
+	}()
+
+	// The full name is counted in characters before version 3.
+	fullName := "Zoë Ångström"
+	algorithm := 1
+	require.NoError(t, writeSites([]mpw.Site{{Name: "masterpasswordapp.com", Counter: 2, Algorithm: &algorithm}}))
+	menu([]string{"--launcher", "launcher", "--password-launcher", "password-launcher", "--full-name", fullName})
+
+	key, err := mpw.MasterKeyForAlgorithm(algorithm, fullName, "banana colored duckling")
+	require.NoError(t, err)
+	expected, err := mpw.SiteResultForAlgorithm(algorithm, key, "masterpasswordapp.com", 2, mpw.Authentication, "", "Long")
+	require.NoError(t, err)
+	password, err := os.ReadFile(copied)
+	require.NoError(t, err)
+	require.Equal(t, expected, string(password))
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// migrationState tracks a change of the master password, which takes as
+// long as changing the password at every site.
+type migrationState struct {
+	OldKeyID string    `json:"old_key_id"`
+	NewKeyID string    `json:"new_key_id"`
+	Started  time.Time `json:"started"`
+	// Migrated are the sites that are done, by name. While the sites store
+	// is encrypted they are written sealed under the old master key
+	// instead, so that the state does not reveal which sites exist.
+	Migrated map[string]time.Time `json:"migrated,omitempty"`
+	Sealed   []byte               `json:"sealed,omitempty"`
+}
+
+// migrationEntry is a site in an export of a migration.
+type migrationEntry struct {
+	Site        string `json:"site"`
+	OldLogin    string `json:"old_login"`
+	NewLogin    string `json:"new_login"`
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+func migrationPath() string {
+	return configDir() + "/migration.json"
+}
+
+// migrateMaster walks through changing the password of every stored site
+// from the one of the old master password to the one of the new master
+// password, and remembers the sites that are done until all are.
+func migrateMaster(args []string) {
+	flags := flag.NewFlagSet("migrate-master", flag.ExitOnError)
+	status := flags.Bool("status", false, "Show the progress of the migration")
+	abort := flags.Bool("abort", false, "Forget the progress of the migration")
+	exportPath := flags.String("export", "", "Write the old and new passwords of the remaining sites to a file encrypted under the new master password")
+	decryptPath := flags.String("decrypt", "", "Print the passwords in an export")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		fmt.Println("usage: mpw migrate-master [--status | --abort | --export FILE | --decrypt FILE]")
+		os.Exit(1)
+	}
+	state, started, err := readMigration()
+	if err != nil {
+		fmt.Printf("error reading migration: %s\n", err.Error())
+		os.Exit(1)
+	}
+	switch {
+	case *abort:
+		err = os.Remove(migrationPath())
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		return
+	case *decryptPath != "":
+		decryptMigration(*decryptPath)
+		return
+	}
+	if *status {
+		if !started {
+			fmt.Println("No master password change in progress.")
+			return
+		}
+		sites, err := readSites()
+		if err != nil {
+			fmt.Printf("error reading sites: %s\n", err.Error())
+			os.Exit(1)
+		}
+		err = openMigration(&state)
+		if err != nil {
+			fmt.Printf("error reading migration: %s\n", err.Error())
+			os.Exit(1)
+		}
+		remaining := remainingSites(sites, state)
+		fmt.Printf("Started %s, %d of %d sites migrated.\n", state.Started.Local().Format("2006-01-02 15:04"),
+			len(sites)-len(remaining), len(sites))
+		for _, site := range remaining {
+			fmt.Printf("  %s\n", site.Name)
+		}
+		return
+	}
+
+	oldKeys, newKeys := migrationKeys(&state, started)
+	newKey := newKeys[mpw.CurrentAlgorithm]
+	// An encrypted sites store stays encrypted under the old master key
+	// until every site is migrated.
+	unlockedMasterKeys = oldKeys
+	err = openMigration(&state)
+	if err != nil {
+		fmt.Printf("error reading migration: %s\n", err.Error())
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	remaining := remainingSites(sites, state)
+	if len(remaining) == 0 && !started {
+		fmt.Println("No sites to migrate.")
+		return
+	}
+	if !started {
+		state.Started = time.Now().UTC().Truncate(time.Second)
+		err = writeMigration(state)
+		if err != nil {
+			fmt.Printf("error writing migration: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if *exportPath != "" {
+		entries := []migrationEntry{}
+		for _, site := range remaining {
+			entry, err := migrationPasswords(oldKeys, newKeys, site)
+			if err != nil {
+				fmt.Printf("password generation error: %s\n", err.Error())
+				os.Exit(1)
+			}
+			entries = append(entries, entry)
+		}
+		b, err := json.Marshal(entries)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		file, err := mpw.Encrypt(newKey, mpw.MigrationScope, b)
+		if err != nil {
+			fmt.Printf("error encrypting export: %s\n", err.Error())
+			os.Exit(1)
+		}
+		err = mpw.WriteFileAtomic(*exportPath, file, false)
+		if err != nil {
+			fmt.Printf("error writing %s: %s\n", *exportPath, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println("the checklist needs a terminal, use --export FILE instead")
+		os.Exit(1)
+	}
+	for i, site := range remaining {
+		entry, err := migrationPasswords(oldKeys, newKeys, site)
+		if err != nil {
+			fmt.Printf("password generation error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("\n[%d/%d] %s\n", i+1, len(remaining), site.Name)
+		if entry.OldLogin == entry.NewLogin {
+			fmt.Printf("  Login:        %s\n", entry.NewLogin)
+		} else {
+			fmt.Printf("  Old login:    %s\n", entry.OldLogin)
+			fmt.Printf("  New login:    %s\n", entry.NewLogin)
+		}
+		fmt.Printf("  Old password: %s\n", entry.OldPassword)
+		fmt.Printf("  New password: %s\n", entry.NewPassword)
+		answer, err := input("Changed at the site? [y]es/[s]kip/[q]uit ")
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+		case "q", "quit":
+			return
+		default:
+			continue
+		}
+		err = migrateSite(site)
+		if err != nil {
+			fmt.Printf("error writing sites: %s\n", err.Error())
+			os.Exit(1)
+		}
+		state.Migrated[site.Name] = time.Now().UTC().Truncate(time.Second)
+		err = writeMigration(state)
+		if err != nil {
+			fmt.Printf("error writing migration: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	sites, err = readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if len(remainingSites(sites, state)) > 0 {
+		return
+	}
+	if sitesEncrypted() {
+		history, err := readHistory()
+		if err == nil {
+			err = mpw.WriteEncryptedSites(sitesPath(), newKey, sites)
+		}
+		if err == nil && history != nil {
+			err = mpw.WriteEncryptedHistory(historyPath(), newKey, history)
+		}
+		if err != nil {
+			fmt.Printf("error writing sites: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	err = os.Remove(migrationPath())
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("\nAll %d sites migrated, use the new master password from now on.\n", len(sites))
+}
+
+// remainingSites lists the sites that are not migrated yet by name.
+func remainingSites(sites []mpw.Site, state migrationState) []mpw.Site {
+	var remaining []mpw.Site
+	for _, site := range sites {
+		if _, done := state.Migrated[site.Name]; !done {
+			remaining = append(remaining, site)
+		}
+	}
+	sort.Slice(remaining, func(i, j int) bool { return remaining[i].Name < remaining[j].Name })
+	return remaining
+}
+
+// migrationKeys asks for the old and the new master password, derives the
+// master keys of every algorithm version from them and checks them against
+// those the migration was started with.
+func migrationKeys(state *migrationState, started bool) ([][]byte, [][]byte) {
+	config, err := readConfig()
+	if err != nil {
+		fmt.Printf("error reading config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if config.FullName == "" {
+		fmt.Println("FULL_NAME missing in the config")
+		os.Exit(1)
+	}
+	oldPassword, err := askSecret("Old Master Password: ")
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	var newPassword string
+	if started {
+		newPassword, err = askSecret("New Master Password: ")
+	} else {
+		newPassword, err = newMasterPassword(config.FullName, config.MinScore, false)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if newPassword == oldPassword {
+		fmt.Println("the new master password is the old one")
+		os.Exit(1)
+	}
+	oldKeys, err := mpw.MasterKeys(config.FullName, oldPassword)
+	if err != nil {
+		fmt.Printf("error deriving master keys: %s\n", err.Error())
+		os.Exit(1)
+	}
+	newKeys, err := mpw.MasterKeys(config.FullName, newPassword)
+	if err != nil {
+		fmt.Printf("error deriving master keys: %s\n", err.Error())
+		os.Exit(1)
+	}
+	oldKey, newKey := oldKeys[mpw.CurrentAlgorithm], newKeys[mpw.CurrentAlgorithm]
+	if !started {
+		fmt.Printf("Old identicon: %s\n", mpw.Identicon(config.FullName, oldPassword, false))
+		fmt.Printf("New identicon: %s\n", mpw.Identicon(config.FullName, newPassword, false))
+		state.OldKeyID = mpw.KeyID(oldKey)
+		state.NewKeyID = mpw.KeyID(newKey)
+		return oldKeys, newKeys
+	}
+	if mpw.KeyID(oldKey) != state.OldKeyID {
+		fmt.Println("the old master password is not the one the migration was started with")
+		os.Exit(1)
+	}
+	if mpw.KeyID(newKey) != state.NewKeyID {
+		fmt.Println("the new master password is not the one the migration was started with")
+		os.Exit(1)
+	}
+	return oldKeys, newKeys
+}
+
+// migrationPasswords derives the logins and passwords of site under the
+// old and the new master keys. The new password uses the current algorithm.
+func migrationPasswords(oldKeys, newKeys [][]byte, site mpw.Site) (migrationEntry, error) {
+	entry := migrationEntry{Site: site.Name}
+	var err error
+	entry.OldLogin, err = loginName(oldKeys[mpw.CurrentAlgorithm], site)
+	if err != nil {
+		return entry, err
+	}
+	entry.OldPassword, err = sitePassword(oldKeys, site)
+	if err != nil {
+		return entry, err
+	}
+	site.Algorithm = nil
+	entry.NewLogin, err = loginName(newKeys[mpw.CurrentAlgorithm], site)
+	if err != nil {
+		return entry, err
+	}
+	entry.NewPassword, err = sitePassword(newKeys, site)
+	return entry, err
+}
+
+// migrateSite records in the store that the password of site was changed
+// to the one of the new master password. Its previous passwords were
+// derived from the old master password, so they are dropped.
+func migrateSite(site mpw.Site) error {
+	sites, err := readSites()
+	if err != nil {
+		return err
+	}
+	stored, found := mpw.FindSite(sites, site.Name)
+	if !found {
+		return nil
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	stored.Algorithm = nil
+	stored.Previous = nil
+	stored.Since = &now
+	return writeSites(mpw.PutSite(sites, stored))
+}
+
+// decryptMigration prints the passwords in an export of a migration.
+func decryptMigration(path string) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	config, err := readConfig()
+	if err != nil {
+		fmt.Printf("error reading config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if config.FullName == "" {
+		fmt.Println("FULL_NAME missing in the config")
+		os.Exit(1)
+	}
+	newPassword, err := askSecret("New Master Password: ")
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	newKey, err := mpw.MasterKey(config.FullName, newPassword)
+	if err != nil {
+		fmt.Printf("error deriving master key: %s\n", err.Error())
+		os.Exit(1)
+	}
+	b, err := mpw.Decrypt(newKey, mpw.MigrationScope, file)
+	if err != nil {
+		fmt.Printf("error decrypting %s: %s\n", path, err.Error())
+		os.Exit(1)
+	}
+	var entries []migrationEntry
+	err = json.Unmarshal(b, &entries)
+	if err != nil {
+		fmt.Printf("error reading %s: %s\n", path, err.Error())
+		os.Exit(1)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SITE\tOLD LOGIN\tNEW LOGIN\tOLD PASSWORD\tNEW PASSWORD")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.Site, entry.OldLogin, entry.NewLogin, entry.OldPassword, entry.NewPassword)
+	}
+	w.Flush()
+}
+
+// readMigration reads the migration in progress, and whether there is one.
+func readMigration() (migrationState, bool, error) {
+	state := migrationState{Migrated: map[string]time.Time{}}
+	b, err := os.ReadFile(migrationPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, false, nil
+	}
+	if err != nil {
+		return state, false, err
+	}
+	err = json.Unmarshal(b, &state)
+	if err != nil {
+		return state, false, err
+	}
+	if state.Migrated == nil {
+		state.Migrated = map[string]time.Time{}
+	}
+	return state, true, nil
+}
+
+// openMigration unseals the migrated sites of state, with the master key
+// the sites store is encrypted under.
+func openMigration(state *migrationState) error {
+	if state.Sealed == nil {
+		return nil
+	}
+	masterKey, err := unlockMasterKey()
+	if err != nil {
+		return err
+	}
+	b, err := mpw.Decrypt(masterKey, mpw.MigrationScope, state.Sealed)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(b, &state.Migrated)
+	if err != nil {
+		return err
+	}
+	state.Sealed = nil
+	return nil
+}
+
+// writeMigration writes state, sealing the migrated sites if the sites
+// store is encrypted.
+func writeMigration(state migrationState) error {
+	if sitesEncrypted() {
+		masterKey, err := unlockMasterKey()
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(state.Migrated)
+		if err != nil {
+			return err
+		}
+		state.Sealed, err = mpw.Encrypt(masterKey, mpw.MigrationScope, b)
+		if err != nil {
+			return err
+		}
+		state.Migrated = nil
+	}
+	b, err := json.MarshalIndent(state, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(configDir(), 0700)
+	if err != nil {
+		return err
+	}
+	return mpw.WriteFileAtomic(migrationPath(), append(b, '\n'), true)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// Browser native messaging host
+//
+// Browser extensions talk to the host over stdin and stdout with JSON
+// messages, each preceded by its length as a 32-bit integer in native byte
+// order, which is little endian on every platform the browsers support.
+// The extension unlocks the host with the master password once, confirms
+// the identicon and key ID with the user, and then derives the password and
+// login name for the active tab.
+
+const nativeHostName = "com.github.emiljoha.mpw"
+
+// maxNativeMessage is the size limit browsers put on messages from the host.
+const maxNativeMessage = 1024 * 1024
+
+type nativeRequest struct {
+	Action         string `json:"action"`
+	FullName       string `json:"fullName,omitempty"`
+	MasterPassword string `json:"masterPassword,omitempty"`
+	URL            string `json:"url,omitempty"`
+}
+
+type nativeResponse struct {
+	Error     string     `json:"error,omitempty"`
+	KeyID     string     `json:"keyId,omitempty"`
+	Identicon string     `json:"identicon,omitempty"`
+	Sites     []mpw.Site `json:"sites,omitempty"`
+	Site      string     `json:"site,omitempty"`
+	Login     string     `json:"login,omitempty"`
+	Password  string     `json:"password,omitempty"`
+}
+
+type nativeHost struct {
+	// masterKeys are the master keys of every algorithm version, and
+	// masterKey the one of the current version.
+	masterKeys [][]byte
+	masterKey  []byte
+	identicon  string
+}
+
+// nativeHostCommand serves the extension, browsers start it with the
+// manifest path or extension origin as arguments which are ignored.
+func nativeHostCommand(args []string) {
+	if len(args) > 0 && args[0] == "install" {
+		installNativeHost(args[1:])
+		return
+	}
+	host := nativeHost{}
+	for {
+		request, err := readNativeMessage(os.Stdin)
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading message: %s\n", err.Error())
+			os.Exit(1)
+		}
+		response, err := host.handle(request)
+		if err != nil {
+			response = nativeResponse{Error: err.Error()}
+		}
+		err = writeNativeMessage(os.Stdout, response)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error writing message: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+func (h *nativeHost) handle(request nativeRequest) (nativeResponse, error) {
+	switch request.Action {
+	case "unlock":
+		fullName := request.FullName
+		if fullName == "" {
+			config, err := readConfig()
+			if err != nil {
+				return nativeResponse{}, err
+			}
+			fullName = config.FullName
+		}
+		if fullName == "" {
+			return nativeResponse{}, errors.New("full name missing")
+		}
+		keys, err := mpw.MasterKeys(fullName, request.MasterPassword)
+		if err != nil {
+			return nativeResponse{}, err
+		}
+		h.masterKeys = keys
+		h.masterKey = keys[mpw.CurrentAlgorithm]
+		h.identicon = mpw.Identicon(fullName, request.MasterPassword, false)
+		return h.identity()
+	case "lock":
+		h.masterKeys = nil
+		h.masterKey = nil
+		h.identicon = ""
+		return nativeResponse{}, nil
+	case "identity":
+		return h.identity()
+	case "list":
+		sites, err := mpw.ReadEncryptedSites(sitesPath(), h.masterKey)
+		if err != nil {
+			return nativeResponse{}, err
+		}
+		return nativeResponse{Sites: sites}, nil
+	case "derive":
+		if h.masterKey == nil {
+			return nativeResponse{}, errors.New("locked")
+		}
+		siteName, err := mpw.CanonicalSiteName(request.URL)
+		if err != nil {
+			return nativeResponse{}, err
+		}
+		sites, err := mpw.ReadEncryptedSites(sitesPath(), h.masterKey)
+		if err != nil {
+			return nativeResponse{}, err
+		}
+		site, found := mpw.FindSite(sites, siteName)
+		if !found {
+			site = mpw.Site{Name: siteName}
+		}
+		login, err := loginName(h.masterKey, site)
+		if err != nil {
+			return nativeResponse{}, err
+		}
+		password, err := sitePassword(h.masterKeys, site)
+		if err != nil {
+			return nativeResponse{}, err
+		}
+		return nativeResponse{Site: siteName, Login: login, Password: password}, nil
+	}
+	return nativeResponse{}, fmt.Errorf("unknown action: %s", request.Action)
+}
+
+func (h *nativeHost) identity() (nativeResponse, error) {
+	if h.masterKey == nil {
+		return nativeResponse{}, errors.New("locked")
+	}
+	return nativeResponse{KeyID: mpw.KeyID(h.masterKey), Identicon: h.identicon}, nil
+}
+
+func readNativeMessage(r io.Reader) (nativeRequest, error) {
+	var length uint32
+	err := binary.Read(r, binary.LittleEndian, &length)
+	if err != nil {
+		return nativeRequest{}, err
+	}
+	if length > maxNativeMessage {
+		return nativeRequest{}, fmt.Errorf("message too large: %d bytes", length)
+	}
+	b := make([]byte, length)
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return nativeRequest{}, err
+	}
+	var request nativeRequest
+	err = json.Unmarshal(b, &request)
+	return request, err
+}
+
+func writeNativeMessage(w io.Writer, response nativeResponse) error {
+	b, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	if len(b) > maxNativeMessage {
+		return fmt.Errorf("message too large: %d bytes", len(b))
+	}
+	err = binary.Write(w, binary.LittleEndian, uint32(len(b)))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// installNativeHost writes the host manifests for Firefox and the Chromium
+// based browsers. The manifests point to a wrapper script since browsers
+// start the host without the native-host argument.
+func installNativeHost(args []string) {
+	fs := flag.NewFlagSet("native-host install", flag.ExitOnError)
+	firefoxExtension := fs.String("firefox-extension", "", "ID of the Firefox extension allowed to use the host")
+	chromiumExtension := fs.String("chromium-extension", "", "ID of the Chromium extension allowed to use the host")
+	fs.Parse(args)
+	if *firefoxExtension == "" && *chromiumExtension == "" {
+		fmt.Println("usage: mpw native-host install [--firefox-extension ID] [--chromium-extension ID]")
+		os.Exit(1)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Printf("error locating executable: %s\n", err.Error())
+		os.Exit(1)
+	}
+	home := os.Getenv("HOME")
+	wrapper := filepath.Join(home, ".local", "share", "mpw", "native-host")
+	err = os.MkdirAll(filepath.Dir(wrapper), 0700)
+	if err == nil {
+		err = os.WriteFile(wrapper, []byte(fmt.Sprintf("#!/bin/sh\nexec '%s' native-host \"$@\"\n", executable)), 0700)
+	}
+	if err != nil {
+		fmt.Printf("error writing %s: %s\n", wrapper, err.Error())
+		os.Exit(1)
+	}
+
+	manifest := map[string]interface{}{
+		"name":        nativeHostName,
+		"description": "Master Password",
+		"path":        wrapper,
+		"type":        "stdio",
+	}
+	manifests := map[string]map[string]interface{}{}
+	if *firefoxExtension != "" {
+		firefox := map[string]interface{}{"allowed_extensions": []string{*firefoxExtension}}
+		manifests[filepath.Join(home, ".mozilla", "native-messaging-hosts")] = firefox
+	}
+	if *chromiumExtension != "" {
+		origin := []string{"chrome-extension://" + *chromiumExtension + "/"}
+		manifests[filepath.Join(home, ".config", "chromium", "NativeMessagingHosts")] = map[string]interface{}{"allowed_origins": origin}
+		manifests[filepath.Join(home, ".config", "google-chrome", "NativeMessagingHosts")] = map[string]interface{}{"allowed_origins": origin}
+	}
+	for dir, allowed := range manifests {
+		for k, v := range manifest {
+			allowed[k] = v
+		}
+		b, err := json.MarshalIndent(allowed, "", "\t")
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		path := filepath.Join(dir, nativeHostName+".json")
+		err = os.MkdirAll(dir, 0755)
+		if err == nil {
+			err = os.WriteFile(path, append(b, '\n'), 0644)
+		}
+		if err != nil {
+			fmt.Printf("error writing %s: %s\n", path, err.Error())
+			os.Exit(1)
+		}
+		fmt.Println(path)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+	"golang.org/x/term"
+)
+
+const pickerPrompt = "Site Name: "
+
+type picker struct {
+	candidates []mpw.Site
+	bumped     map[string]bool
+	query      []rune
+	matches    []mpw.Site
+	selected   int
+	offset     int
+}
+
+// pickSite lets the user choose a site from the stored sites and the site
+// history with a full-screen fuzzy finder. Ctrl-R bumps the counter of the
+// highlighted site, the returned bool reports if the chosen site was bumped.
+func pickSite(sites []mpw.Site, history []string) (mpw.Site, bool, error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return mpw.Site{}, false, err
+	}
+	defer term.Restore(fd, state)
+	fmt.Print("\033[?1049h")
+	defer fmt.Print("\033[?1049l")
+
+	p := picker{candidates: pickerCandidates(sites, history), bumped: map[string]bool{}}
+	p.filter()
+	buf := make([]byte, 64)
+	for {
+		p.render(fd)
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return mpw.Site{}, false, err
+		}
+		for keys := buf[:n]; len(keys) > 0; {
+			switch {
+			case keys[0] == 0x03 || (keys[0] == 0x1b && len(keys) == 1):
+				return mpw.Site{}, false, errors.New("no site selected")
+			case keys[0] == '\r' || keys[0] == '\n':
+				if len(p.matches) == 0 {
+					keys = keys[1:]
+					continue
+				}
+				site := p.matches[p.selected]
+				return site, p.bumped[site.Name], nil
+			case keys[0] == 0x12:
+				p.bump()
+			case keys[0] == 0x10:
+				p.move(-1)
+			case keys[0] == 0x0e:
+				p.move(1)
+			case keys[0] == 0x7f || keys[0] == 0x08:
+				if len(p.query) > 0 {
+					p.query = p.query[:len(p.query)-1]
+					p.filter()
+				}
+			case keys[0] == 0x15:
+				p.query = nil
+				p.filter()
+			case keys[0] == 0x1b && len(keys) >= 3 && (keys[1] == '[' || keys[1] == 'O'):
+				switch keys[2] {
+				case 'A':
+					p.move(-1)
+				case 'B':
+					p.move(1)
+				}
+				keys = keys[3:]
+				continue
+			default:
+				r, size := utf8.DecodeRune(keys)
+				if unicode.IsPrint(r) {
+					p.query = append(p.query, r)
+					p.filter()
+				}
+				keys = keys[size:]
+				continue
+			}
+			keys = keys[1:]
+		}
+	}
+}
+
+// pickerCandidates lists the sites in the history, most recent first,
+// followed by the stored sites that have not been used recently.
+func pickerCandidates(sites []mpw.Site, history []string) []mpw.Site {
+	candidates := make([]mpw.Site, 0, len(sites)+len(history))
+	seen := map[string]bool{}
+	for _, name := range history {
+		site, found := mpw.FindSite(sites, name)
+		if !found {
+			site = mpw.Site{Name: name}
+		}
+		candidates = append(candidates, site)
+		seen[name] = true
+	}
+	for _, site := range sites {
+		if !seen[site.Name] {
+			candidates = append(candidates, site)
+		}
+	}
+	return candidates
+}
+
+func (p *picker) filter() {
+	query := string(p.query)
+	type match struct {
+		site  mpw.Site
+		score int
+	}
+	var matches []match
+	exact := false
+	for _, site := range p.candidates {
+		score, ok := fuzzyScore(query, site.Name)
+		if ok {
+			matches = append(matches, match{site, score})
+		}
+		exact = exact || site.Name == query
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	p.matches = p.matches[:0]
+	for _, m := range matches {
+		p.matches = append(p.matches, m.site)
+	}
+	if query != "" && !exact {
+		p.matches = append(p.matches, mpw.Site{Name: query})
+	}
+	p.selected = 0
+	p.offset = 0
+}
+
+func (p *picker) move(delta int) {
+	p.selected += delta
+	if p.selected < 0 {
+		p.selected = 0
+	}
+	if p.selected >= len(p.matches) {
+		p.selected = len(p.matches) - 1
+	}
+}
+
+func (p *picker) bump() {
+	if len(p.matches) == 0 {
+		return
+	}
+	site := &p.matches[p.selected]
+	site.Counter = siteCounter(*site) + 1
+	p.bumped[site.Name] = true
+	for i := range p.candidates {
+		if p.candidates[i].Name == site.Name {
+			p.candidates[i].Counter = site.Counter
+			return
+		}
+	}
+	p.candidates = append(p.candidates, *site)
+}
+
+func (p *picker) render(fd int) {
+	_, height, err := term.GetSize(fd)
+	if err != nil || height < 4 {
+		height = 24
+	}
+	rows := height - 2
+	if p.selected < p.offset {
+		p.offset = p.selected
+	}
+	if p.selected >= p.offset+rows {
+		p.offset = p.selected - rows + 1
+	}
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	for i := p.offset; i < len(p.matches) && i < p.offset+rows; i++ {
+		fmt.Fprintf(&b, "\033[%d;1H", i-p.offset+2)
+		line := "  " + p.matches[i].Name
+		if !p.known(p.matches[i].Name) {
+			line += " (new)"
+		}
+		if i == p.selected {
+			line = "\033[7m>" + line[1:] + "\033[0m"
+		}
+		b.WriteString(line)
+	}
+	fmt.Fprintf(&b, "\033[%d;1H\033[2m%s\033[0m", height, p.status())
+	fmt.Fprintf(&b, "\033[1;1H%s%s", pickerPrompt, string(p.query))
+	fmt.Print(b.String())
+}
+
+func (p *picker) known(name string) bool {
+	for _, site := range p.candidates {
+		if site.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *picker) status() string {
+	if len(p.matches) == 0 {
+		return fmt.Sprintf("%d sites", len(p.candidates))
+	}
+	site := p.matches[p.selected]
+	login := site.Login
+	if login == "" {
+		login = "-"
+	}
+	status := fmt.Sprintf("type: %s  counter: %d  login: %s", siteType(site), siteCounter(site), login)
+	if p.bumped[site.Name] {
+		status += "  (counter bumped)"
+	}
+	return status
+}
+
+// siteCounter is the counter used for site, sites without a stored counter
+// use the first one.
+func siteCounter(site mpw.Site) int {
+	if site.Counter == 0 {
+		return 1
+	}
+	return site.Counter
+}
+
+// siteKeyCounter is the counter of the keys derived for site, sites
+// without a stored key counter use the first one.
+func siteKeyCounter(site mpw.Site) int {
+	if site.KeyCounter == 0 {
+		return 1
+	}
+	return site.KeyCounter
+}
+
+// siteType is the result type used for site, sites without a stored type
+// use Long passwords.
+func siteType(site mpw.Site) mpw.ResultType {
+	if site.Type == "" {
+		return "Long"
+	}
+	return site.Type
+}
+
+// siteAlgorithm is the algorithm version of site's password.
+func siteAlgorithm(site mpw.Site) int {
+	if site.Algorithm == nil {
+		return mpw.CurrentAlgorithm
+	}
+	return *site.Algorithm
+}
+
+// fuzzyScore reports whether all characters of query appear in name in
+// order, ignoring case, and scores the match. Consecutive characters and
+// characters at the start of a word score higher, as do shorter names.
+func fuzzyScore(query, name string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+	q := []rune(strings.ToLower(query))
+	n := []rune(strings.ToLower(name))
+	score := 0
+	qi := 0
+	previous := -2
+	for ni := 0; ni < len(n) && qi < len(q); ni++ {
+		if n[ni] != q[qi] {
+			continue
+		}
+		score++
+		if ni == previous+1 {
+			score += 4
+		}
+		if ni == 0 || strings.ContainsRune(".-_ @/", n[ni-1]) {
+			score += 3
+		}
+		previous = ni
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	return score*100 - len(n), true
+}
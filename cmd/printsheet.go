@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// printSheet writes a recovery sheet listing the parameters of every site
+// and of the keys in SSH_KEYS and WIREGUARD_KEYS, for printing. With the
+// master password it suffices to derive every password and key again.
+func printSheet(args []string) {
+	fs := flag.NewFlagSet("print-sheet", flag.ExitOnError)
+	format := fs.String("format", "text", "Format of the sheet: text, html")
+	outputPath := fs.String("o", "", "File to write, stdout if not given")
+	force := fs.Bool("force", false, "Overwrite the output file if it exists")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Println("usage: mpw print-sheet [--format text|html] [-o FILE] [--force]")
+		os.Exit(1)
+	}
+	if *format != "text" && *format != "html" {
+		fmt.Printf("unsupported sheet format: %s\n", *format)
+		os.Exit(1)
+	}
+	if *outputPath != "" && !*force {
+		if _, err := os.Lstat(*outputPath); err == nil {
+			fmt.Printf("%s exists, use --force to overwrite it\n", *outputPath)
+			os.Exit(1)
+		}
+	}
+	config, err := readConfig()
+	if err != nil {
+		fmt.Printf("error reading config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	masterKey, err := unlockMasterKey()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	// The master password was asked for by unlockMasterKey.
+	masterPassword, _ := askMasterPassword()
+
+	sheet := mpw.Sheet{
+		FullName:  config.FullName,
+		KeyID:     mpw.KeyID(masterKey),
+		Identicon: mpw.Identicon(config.FullName, masterPassword, false),
+		Printed:   time.Now(),
+	}
+	sorted := append([]mpw.Site(nil), sites...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for _, site := range sorted {
+		sheet.Sites = append(sheet.Sites, sheetSite(site))
+	}
+	for _, name := range config.SSHKeys {
+		sheet.Keys = append(sheet.Keys, sheetKey(sites, name, "SSH Ed25519 key", mpw.SSHScope))
+	}
+	for _, name := range config.WireGuardKeys {
+		sheet.Keys = append(sheet.Keys, sheetKey(sites, name, "WireGuard key", mpw.WireGuardScope))
+	}
+
+	var out bytes.Buffer
+	if *format == "html" {
+		err = mpw.WriteSheetHTML(&out, sheet)
+	} else {
+		err = mpw.WriteSheetText(&out, sheet)
+	}
+	if err != nil {
+		fmt.Printf("error writing sheet: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if *outputPath == "" {
+		os.Stdout.Write(out.Bytes())
+		return
+	}
+	err = mpw.WriteFileAtomic(*outputPath, out.Bytes(), *force)
+	if err != nil {
+		fmt.Printf("error writing %s: %s\n", *outputPath, err.Error())
+		os.Exit(1)
+	}
+}
+
+// sheetSite lists the parameters of site's password and login name.
+func sheetSite(site mpw.Site) mpw.SheetSite {
+	resultType := string(siteType(site))
+	if resolved, err := resolveResultType(siteType(site)); err == nil {
+		resultType = string(resolved)
+		if resolved == mpw.Words && site.Passphrase != nil {
+			resultType += " (" + site.Passphrase.String() + ")"
+		}
+	}
+	login := site.Login
+	if login == "" {
+		login = "derived"
+	}
+	return mpw.SheetSite{
+		Name:      site.Name,
+		Counter:   siteCounter(site),
+		Type:      resultType,
+		Algorithm: siteAlgorithm(site),
+		Login:     login,
+	}
+}
+
+// sheetKey lists the parameters of the key derived for the site name in
+// scope, with the key counter stored for the site.
+func sheetKey(sites []mpw.Site, name string, purpose string, scope string) mpw.SheetKey {
+	site, found := mpw.FindSite(sites, name)
+	if !found {
+		site = mpw.Site{Name: name}
+	}
+	return mpw.SheetKey{Name: name, Counter: siteKeyCounter(site), Purpose: purpose, Scope: scope}
+}
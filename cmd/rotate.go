@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// rotate bumps the counter of a site and shows the current and the new
+// password, so that both are at hand while changing it at the site. The
+// current password is kept in the site's previous passwords.
+func rotate(args []string) {
+	if len(args) != 1 {
+		fmt.Println("usage: mpw rotate SITE")
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	site, found := mpw.FindSite(sites, args[0])
+	if !found {
+		site = mpw.Site{Name: args[0]}
+	}
+	keys, err := unlockMasterKeys()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	current, err := sitePassword(keys, site)
+	if err != nil {
+		fmt.Printf("password generation error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	rotated := mpw.RotateSite(site, siteCounter(site)+1, time.Now())
+	next, err := sitePassword(keys, rotated)
+	if err != nil {
+		fmt.Printf("password generation error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	err = writeSites(mpw.PutSite(sites, rotated))
+	if err != nil {
+		fmt.Printf("error writing sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("Current password (counter %d): %s\n", siteCounter(site), current)
+	fmt.Printf("New password (counter %d):     %s\n", siteCounter(rotated), next)
+}
+
+// show prints the password of a site with its stored parameters, its
+// password before the last rotation, or the counters it has used.
+func show(args []string) {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	counterHistory := fs.Bool("counter-history", false, "List the counters the site has used")
+	previous := fs.Bool("previous", false, "Show the password before the last rotation")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 || (*counterHistory && *previous) {
+		fmt.Println("usage: mpw show SITE [--counter-history | --previous]")
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	site, found := mpw.FindSite(sites, positional[0])
+	if !found {
+		site = mpw.Site{Name: positional[0]}
+	}
+
+	if *counterHistory {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "COUNTER\tTYPE\tALGORITHM\tSINCE\tRETIRED")
+		for _, p := range site.Previous {
+			old := mpw.Site{Counter: p.Counter, Type: p.Type, Algorithm: p.Algorithm}
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n", p.Counter, siteType(old), siteAlgorithm(old), formatSince(p.Since), p.Retired.Local().Format("2006-01-02 15:04"))
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n", siteCounter(site), siteType(site), siteAlgorithm(site), formatSince(site.Since), "current")
+		w.Flush()
+		return
+	}
+	if *previous {
+		if len(site.Previous) == 0 {
+			fmt.Printf("%s has not been rotated\n", site.Name)
+			os.Exit(1)
+		}
+		p := site.Previous[len(site.Previous)-1]
+		site.Counter, site.Type, site.Algorithm = p.Counter, p.Type, p.Algorithm
+	}
+	keys, err := unlockMasterKeys()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	password, err := sitePassword(keys, site)
+	if err != nil {
+		fmt.Printf("password generation error: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if !*previous {
+		err = recordUse(site.Name)
+		if err != nil {
+			fmt.Printf("error updating sites: %s\n", err.Error())
+		}
+	}
+	fmt.Println(password)
+}
+
+func formatSince(since *time.Time) string {
+	if since == nil {
+		return "unknown"
+	}
+	return since.Local().Format("2006-01-02 15:04")
+}
+
+// parseInterspersed parses the flags of fs in args, also those that follow
+// positional arguments, and returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
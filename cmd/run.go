@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// run starts a command with derived secrets in its environment. The env
+// file maps variable names to site specs, e.g.
+//
+//	DB_USER=db.example purpose=Identification
+//	DB_PASSWORD=db.example counter=2 type=Maximum
+//
+// The secrets are masked wherever they appear in the output of the command.
+func run(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	envFile := fs.String("env-file", "", "File mapping environment variables to site specs")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mpw run --env-file FILE -- COMMAND [ARGS...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *envFile == "" || fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	specs, err := readEnvFile(*envFile, sites)
+	if err != nil {
+		fmt.Printf("error reading %s: %s\n", *envFile, err.Error())
+		os.Exit(1)
+	}
+	keys, err := unlockMasterKeys()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	env := os.Environ()
+	var secrets []string
+	for name, spec := range specs {
+		value, err := spec.derive(keys)
+		if err != nil {
+			fmt.Printf("error deriving %s: %s\n", name, err.Error())
+			os.Exit(1)
+		}
+		env = append(env, name+"="+value)
+		secrets = append(secrets, value)
+	}
+
+	cmd := exec.Command(fs.Arg(0), fs.Args()[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	stdout := newMaskingWriter(os.Stdout, secrets)
+	stderr := newMaskingWriter(os.Stderr, secrets)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err = cmd.Start()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	// Interrupts from the terminal reach the command directly.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for s := range signals {
+			if s != os.Interrupt {
+				cmd.Process.Signal(s)
+			}
+		}
+	}()
+	err = cmd.Wait()
+	stdout.Flush()
+	stderr.Flush()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code := exitErr.ExitCode()
+		if code < 0 {
+			code = 1
+		}
+		os.Exit(code)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
+
+func readEnvFile(path string, sites []mpw.Site) (map[string]siteSpec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	specs := map[string]siteSpec{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, spec, found := strings.Cut(text, "=")
+		if !found || !envName.MatchString(name) {
+			return nil, fmt.Errorf("line %d: expected NAME=site [options]", line)
+		}
+		specs[name], err = parseSiteSpec(strings.Fields(spec), sites)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return specs, scanner.Err()
+}
+
+const mask = "*****"
+
+// maskingWriter replaces the secrets in everything written through it.
+// A tail that could be the start of a secret is held back until the next
+// write shows whether it is.
+type maskingWriter struct {
+	w       io.Writer
+	secrets [][]byte
+	pending []byte
+}
+
+func newMaskingWriter(w io.Writer, secrets []string) *maskingWriter {
+	m := &maskingWriter{w: w}
+	for _, secret := range secrets {
+		if secret != "" {
+			m.secrets = append(m.secrets, []byte(secret))
+		}
+	}
+	// Longer secrets first so that a secret containing another is masked
+	// as a whole.
+	sort.Slice(m.secrets, func(i, j int) bool { return len(m.secrets[i]) > len(m.secrets[j]) })
+	return m
+}
+
+func (m *maskingWriter) Write(p []byte) (int, error) {
+	m.pending = append(m.pending, p...)
+	for _, secret := range m.secrets {
+		m.pending = bytes.ReplaceAll(m.pending, secret, []byte(mask))
+	}
+	hold := 0
+	for _, secret := range m.secrets {
+		for k := len(secret) - 1; k > hold; k-- {
+			if k <= len(m.pending) && bytes.HasSuffix(m.pending, secret[:k]) {
+				hold = k
+				break
+			}
+		}
+	}
+	_, err := m.w.Write(m.pending[:len(m.pending)-hold])
+	m.pending = append(m.pending[:0], m.pending[len(m.pending)-hold:]...)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes the tail held back.
+func (m *maskingWriter) Flush() error {
+	_, err := m.w.Write(m.pending)
+	m.pending = m.pending[:0]
+	return err
+}
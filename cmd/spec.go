@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+var purposeAbbreviations = map[string]mpw.KeyPurpose{
+	"a":     mpw.Authentication,
+	"auth":  mpw.Authentication,
+	"i":     mpw.Identification,
+	"ident": mpw.Identification,
+	"r":     mpw.Recovery,
+	"rec":   mpw.Recovery,
+}
+
+// resolvePurpose expands the abbreviations of the key purposes.
+func resolvePurpose(purpose string) (mpw.KeyPurpose, error) {
+	switch mpw.KeyPurpose(purpose) {
+	case mpw.Authentication, mpw.Identification, mpw.Recovery:
+		return mpw.KeyPurpose(purpose), nil
+	}
+	full, ok := purposeAbbreviations[purpose]
+	if !ok {
+		return "", fmt.Errorf("key purpose not valid: %s", purpose)
+	}
+	return full, nil
+}
+
+// siteSpec selects a single derived value, written as the site name
+// followed by optional counter=, type=, purpose= and context= options.
+// Options that are not given default to the parameters in the sites store.
+type siteSpec struct {
+	Name    string
+	Counter int
+	Type    mpw.ResultType
+	Purpose mpw.KeyPurpose
+	Context string
+	// Algorithm is the algorithm version stored for the site's password.
+	Algorithm int
+	// Login is the login stored for the site, used instead of a derived
+	// login name unless the counter or type is given.
+	Login string
+	// site is the stored site with the counter and type of the spec, from
+	// which passwords are derived like for mpw SITE.
+	site mpw.Site
+}
+
+func parseSiteSpec(fields []string, sites []mpw.Site) (siteSpec, error) {
+	if len(fields) == 0 || strings.Contains(fields[0], "=") {
+		return siteSpec{}, fmt.Errorf("site name missing in %q", strings.Join(fields, " "))
+	}
+	spec := siteSpec{Name: fields[0], Purpose: mpw.Authentication, Algorithm: mpw.CurrentAlgorithm}
+	explicit := false
+	for _, field := range fields[1:] {
+		key, value, found := strings.Cut(field, "=")
+		if !found {
+			return siteSpec{}, fmt.Errorf("option %q is not key=value", field)
+		}
+		var err error
+		switch key {
+		case "counter", "c":
+			spec.Counter, err = strconv.Atoi(value)
+			explicit = true
+		case "type", "t":
+			spec.Type, err = resolveResultType(mpw.ResultType(value))
+			explicit = true
+		case "purpose", "p":
+			spec.Purpose, err = resolvePurpose(value)
+		case "context", "C":
+			spec.Context = value
+		default:
+			err = fmt.Errorf("unknown option %q", key)
+		}
+		if err != nil {
+			return siteSpec{}, err
+		}
+	}
+	site, found := mpw.FindSite(sites, spec.Name)
+	if !found {
+		site = mpw.Site{Name: spec.Name}
+	}
+	switch spec.Purpose {
+	case mpw.Authentication:
+		spec.Algorithm = siteAlgorithm(site)
+		if spec.Counter == 0 {
+			spec.Counter = siteCounter(site)
+		}
+		if spec.Type == "" {
+			resultType, err := resolveResultType(siteType(site))
+			if err != nil {
+				return siteSpec{}, err
+			}
+			spec.Type = resultType
+		}
+		spec.site = site
+		spec.site.Counter = spec.Counter
+		spec.site.Type = spec.Type
+	case mpw.Identification:
+		if !explicit {
+			spec.Login = site.Login
+		}
+		if spec.Type == "" {
+			spec.Type = "Name"
+		}
+	case mpw.Recovery:
+		if spec.Type == "" {
+			spec.Type = "Phrase"
+		}
+	}
+	if spec.Counter == 0 {
+		spec.Counter = 1
+	}
+	return spec, nil
+}
+
+// derive derives the value of spec from the master key of its algorithm
+// version in keys. Passwords are derived by sitePassword, with the
+// passphrase options stored for the site.
+func (spec siteSpec) derive(keys [][]byte) (string, error) {
+	if spec.Login != "" {
+		return spec.Login, nil
+	}
+	if spec.Purpose == mpw.Authentication && spec.Context == "" {
+		return sitePassword(keys, spec.site)
+	}
+	if spec.Algorithm < 0 || spec.Algorithm >= len(keys) {
+		return "", fmt.Errorf("%s: algorithm version %d not found", spec.Name, spec.Algorithm)
+	}
+	return mpw.SiteResultForAlgorithm(spec.Algorithm, keys[spec.Algorithm], spec.Name, spec.Counter, spec.Purpose, spec.Context, spec.Type)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// sshPubkey prints the OpenSSH public key derived for a site.
+func sshPubkey(args []string) {
+	fs := flag.NewFlagSet("ssh-pubkey", flag.ExitOnError)
+	counter := fs.Int("c", 0, "Key counter, defaults to the stored key counter")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Println("usage: mpw ssh-pubkey [-c COUNTER] SITE")
+		os.Exit(1)
+	}
+	keys, err := sshAgentKeys(fs.Args(), *counter)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	fmt.Println(mpw.SSHPublicKey(keys[0].Key.Public().(ed25519.PublicKey), keys[0].Comment))
+}
+
+// sshAgent serves the keys derived for the sites given as arguments, or
+// SSH_KEYS in the config, over the SSH agent protocol until it is stopped.
+func sshAgent(args []string) {
+	fs := flag.NewFlagSet("ssh-agent", flag.ExitOnError)
+	socket := fs.String("socket", filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "mpw-ssh-agent.sock"), "Path of the agent socket")
+	fs.Parse(args)
+	siteNames := fs.Args()
+	if len(siteNames) == 0 {
+		config, err := readConfig()
+		if err != nil {
+			fmt.Printf("error reading config: %s\n", err.Error())
+			os.Exit(1)
+		}
+		siteNames = config.SSHKeys
+	}
+	if len(siteNames) == 0 {
+		fmt.Println("usage: mpw ssh-agent [--socket PATH] SITE... or SSH_KEYS in the config")
+		os.Exit(1)
+	}
+	keys, err := sshAgentKeys(siteNames, 0)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	syscall.Umask(0077)
+	listener, err := net.Listen("unix", *socket)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+	fmt.Printf("SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", *socket)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// The listener removes the socket file when closed.
+			return
+		}
+		go func() {
+			defer conn.Close()
+			err := mpw.ServeSSHAgent(conn, keys)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "agent connection error: %s\n", err.Error())
+			}
+		}()
+	}
+}
+
+// sshAgentKeys derives the keys of siteNames, with counter or else the
+// stored key counters.
+func sshAgentKeys(siteNames []string, counter int) ([]mpw.SSHAgentKey, error) {
+	sites, err := readSites()
+	if err != nil {
+		return nil, err
+	}
+	masterKey, err := unlockMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	var keys []mpw.SSHAgentKey
+	for _, siteName := range siteNames {
+		site, found := mpw.FindSite(sites, siteName)
+		if !found {
+			site = mpw.Site{Name: siteName}
+		}
+		if counter != 0 {
+			site.KeyCounter = counter
+		}
+		key, err := mpw.SSHKey(masterKey, site.Name, siteKeyCounter(site))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, mpw.SSHAgentKey{Key: key, Comment: site.Name})
+	}
+	return keys, nil
+}
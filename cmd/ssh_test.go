@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+func TestKeysSurviveRotation(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	require.NoError(t, writeConfig(Config{FullName: "Robert Lee Mitchell"}))
+	masterPassword := "banana colored duckling"
+	askedMasterPassword = &masterPassword
+	defer func() {
+		askedMasterPassword = nil
+		unlockedMasterKeys = nil
+	}()
+	masterKey, err := unlockMasterKey()
+	require.NoError(t, err)
+
+	rotated := mpw.RotateSite(mpw.Site{Name: "github.com"}, 2, time.Now())
+	require.NoError(t, writeSites([]mpw.Site{rotated}))
+	keys, err := sshAgentKeys([]string{"github.com"}, 0)
+	require.NoError(t, err)
+	expected, err := mpw.SSHKey(masterKey, "github.com", 1)
+	require.NoError(t, err)
+	require.Equal(t, expected, keys[0].Key)
+
+	rotated.KeyCounter = 2
+	require.NoError(t, writeSites([]mpw.Site{rotated}))
+	keys, err = sshAgentKeys([]string{"github.com"}, 0)
+	require.NoError(t, err)
+	require.NotEqual(t, expected, keys[0].Key)
+	require.Equal(t, 2, siteKeyCounter(rotated))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// mergeDriver merges the sites store in git, registered for it by sync.
+const mergeDriver = "mpw merge-sites %O %A %B"
+
+// syncSites commits the sites store in the config directory, if that is a
+// git repository, and pulls and pushes it, merging it with merge-sites.
+func syncSites(args []string) {
+	if len(args) != 0 {
+		fmt.Println("usage: mpw sync")
+		os.Exit(1)
+	}
+	dir := configDir()
+	if _, err := gitOutput(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		fmt.Printf("%s is not a git repository, create it with git -C %s init and add a remote to sync with\n", dir, dir)
+		os.Exit(1)
+	}
+	err := gitRun(dir, "config", "merge.mpw-sites.name", "mpw sites store merge")
+	if err == nil {
+		err = gitRun(dir, "config", "merge.mpw-sites.driver", mergeDriver)
+	}
+	if err != nil {
+		fmt.Printf("error configuring the merge driver: %s\n", err.Error())
+		os.Exit(1)
+	}
+	err = addGitAttribute(filepath.Join(dir, ".gitattributes"), filepath.Base(sitesPath())+" merge=mpw-sites")
+	if err != nil {
+		fmt.Printf("error writing .gitattributes: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	// Stores of earlier versions are converted to one site per line before
+	// they are first committed.
+	b, err := os.ReadFile(sitesPath())
+	if err == nil && bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		sites, err := mpw.ReadSites(sitesPath())
+		if err == nil {
+			err = mpw.WriteSites(sitesPath(), sites)
+		}
+		if err != nil {
+			fmt.Printf("error converting sites: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	paths := []string{".gitattributes"}
+	if _, err := os.Stat(sitesPath()); err == nil {
+		paths = append(paths, filepath.Base(sitesPath()))
+	}
+	err = gitRun(dir, append([]string{"add", "--"}, paths...)...)
+	if err != nil {
+		fmt.Printf("error adding sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if _, err := gitOutput(dir, "diff", "--cached", "--quiet"); err != nil {
+		host, _ := os.Hostname()
+		err = gitRun(dir, "commit", "--quiet", "-m", "Update sites on "+host)
+		if err != nil {
+			fmt.Printf("error committing sites: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	remotes, err := gitOutput(dir, "remote")
+	if err != nil || strings.TrimSpace(remotes) == "" {
+		fmt.Println("no git remote to sync with, add one with git remote add")
+		os.Exit(1)
+	}
+	if _, err := gitOutput(dir, "rev-parse", "--abbrev-ref", "@{upstream}"); err != nil {
+		// The first sync publishes the branch on the first remote.
+		remote := strings.Fields(remotes)[0]
+		err = gitRun(dir, "push", "--set-upstream", remote, "HEAD")
+		if err != nil {
+			fmt.Printf("error syncing sites: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	err = gitRun(dir, "pull", "--no-rebase", "--no-edit")
+	if err == nil {
+		err = gitRun(dir, "push")
+	}
+	if err != nil {
+		fmt.Printf("error syncing sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+// mergeSites is the git merge driver of the sites store. It merges the
+// sites in the files of the common ancestor, ours and theirs into ours.
+func mergeSites(args []string) {
+	if len(args) != 3 {
+		fmt.Println("usage: mpw merge-sites BASE OURS THEIRS")
+		os.Exit(1)
+	}
+	var versions [3][]mpw.Site
+	encrypted := false
+	for i, path := range args {
+		b, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		encrypted = encrypted || mpw.Encrypted(b)
+		versions[i], err = readSitesFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading %s: %s\n", path, err.Error())
+			os.Exit(1)
+		}
+	}
+	merged := mpw.MergeSites(versions[0], versions[1], versions[2])
+	var err error
+	if encrypted {
+		var masterKey []byte
+		masterKey, err = unlockMasterKey()
+		if err == nil {
+			err = mpw.WriteEncryptedSites(args[1], masterKey, merged)
+		}
+	} else {
+		err = mpw.WriteSites(args[1], merged)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing %s: %s\n", args[1], err.Error())
+		os.Exit(1)
+	}
+}
+
+// addGitAttribute adds line to the .gitattributes file at path unless it
+// is there already.
+func addGitAttribute(path string, line string) error {
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, existing := range strings.Split(string(b), "\n") {
+		if strings.TrimSpace(existing) == line {
+			return nil
+		}
+	}
+	if len(b) > 0 && !bytes.HasSuffix(b, []byte("\n")) {
+		b = append(b, '\n')
+	}
+	return os.WriteFile(path, append(b, line+"\n"...), 0644)
+}
+
+func gitRun(dir string, args ...string) error {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	return string(out), err
+}
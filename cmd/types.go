@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// resultTypes are the result types in the order of the -t help text.
+var resultTypes = []mpw.ResultType{"Maximum", "Long", "Medium", "Basic", "Short", "PIN", "Name", "Phrase", mpw.Words}
+
+// Guessing rates of an offline attacker with a few GPUs, against a site
+// that stored its password hashes with a fast hash such as SHA-256 and with
+// a slow one such as bcrypt.
+const (
+	fastHashGuesses = 1e10
+	slowHashGuesses = 1e4
+)
+
+// types prints the strength of every result type.
+func types(args []string) {
+	if len(args) != 0 {
+		fmt.Println("usage: mpw types")
+		os.Exit(1)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tLENGTH\tCLASSES\tENTROPY\tMIN-ENTROPY\tFAST HASH\tSLOW HASH")
+	for _, resultType := range resultTypes {
+		strength, err := mpw.ResultTypeStrength(resultType)
+		if err != nil {
+			fmt.Printf("error computing strength of %s: %s\n", resultType, err.Error())
+			os.Exit(1)
+		}
+		length := fmt.Sprint(strength.MinLength)
+		if strength.MaxLength != strength.MinLength {
+			length = fmt.Sprintf("%d-%d", strength.MinLength, strength.MaxLength)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.1f bits\t%.1f bits\t%s\t%s\n",
+			resultType, length, strings.Join(strength.Classes, ","),
+			strength.Entropy, strength.MinEntropy,
+			crackTime(strength.Entropy, fastHashGuesses), crackTime(strength.Entropy, slowHashGuesses))
+	}
+	w.Flush()
+	fmt.Println("\nCracking times are for finding the password after half of the guesses,")
+	fmt.Printf("at %.0e guesses per second for a fast hash and %.0e for a slow hash.\n", fastHashGuesses, slowHashGuesses)
+}
+
+// crackTime formats the time to search half of 2^bits passwords at rate
+// guesses per second.
+func crackTime(bits float64, rate float64) string {
+	return humanDuration(math.Exp2(bits-1) / rate)
+}
+
+// humanDuration formats seconds in the largest unit that fits.
+func humanDuration(seconds float64) string {
+	units := []struct {
+		name    string
+		seconds float64
+	}{
+		{"year", 365.25 * 24 * 3600},
+		{"day", 24 * 3600},
+		{"hour", 3600},
+		{"minute", 60},
+		{"second", 1},
+	}
+	if seconds < 1 {
+		return "instant"
+	}
+	for _, unit := range units {
+		if seconds < unit.seconds {
+			continue
+		}
+		n := math.Round(seconds / unit.seconds)
+		switch {
+		case n >= 1e6:
+			return fmt.Sprintf("%.0e %ss", n, unit.name)
+		case n == 1:
+			return fmt.Sprintf("1 %s", unit.name)
+		}
+		return fmt.Sprintf("%.0f %ss", n, unit.name)
+	}
+	panic("unreachable")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// upgradingSite is a site whose passwords use an earlier algorithm version.
+type upgradingSite struct {
+	Site    mpw.Site
+	Current string
+	New     string
+}
+
+// upgrade moves the sites that use an earlier algorithm version to the
+// current one. Sites whose password is the same under both are upgraded
+// right away, the others once their password was changed at the site.
+func upgrade(args []string) {
+	fs := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Only report the sites that use an earlier algorithm version")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Println("usage: mpw upgrade [--dry-run]")
+		os.Exit(1)
+	}
+	config, err := readConfig()
+	if err != nil {
+		fmt.Printf("error reading config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if config.FullName == "" {
+		fmt.Println("FULL_NAME missing in the config")
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	var outdated []mpw.Site
+	for _, site := range sites {
+		if algorithm := siteAlgorithm(site); algorithm < 0 || algorithm > mpw.CurrentAlgorithm {
+			fmt.Printf("%s: algorithm version %d not found\n", site.Name, algorithm)
+			os.Exit(1)
+		}
+		if siteAlgorithm(site) < mpw.CurrentAlgorithm {
+			outdated = append(outdated, site)
+		}
+	}
+	if len(outdated) == 0 {
+		fmt.Printf("All sites use algorithm version %d.\n", mpw.CurrentAlgorithm)
+		return
+	}
+	masterPassword, err := askMasterPassword()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	keys, err := mpw.MasterKeys(config.FullName, masterPassword)
+	if err != nil {
+		fmt.Printf("error deriving master keys: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	var unchanged, changed []upgradingSite
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SITE\tALGORITHM\tDIFFERS\tREASON")
+	for _, site := range outdated {
+		current, err := sitePassword(keys, site)
+		if err != nil {
+			fmt.Printf("password generation error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		upgraded := site
+		upgraded.Algorithm = nil
+		next, err := sitePassword(keys, upgraded)
+		if err != nil {
+			fmt.Printf("password generation error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		differs, reason := "no", "-"
+		if differences := mpw.AlgorithmDifferences(siteAlgorithm(site), config.FullName, site.Name); len(differences) > 0 {
+			reason = strings.Join(differences, ", ")
+		}
+		if next == current {
+			unchanged = append(unchanged, upgradingSite{site, current, next})
+		} else {
+			differs = "yes"
+			changed = append(changed, upgradingSite{site, current, next})
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", site.Name, siteAlgorithm(site), differs, reason)
+	}
+	w.Flush()
+	if *dryRun {
+		return
+	}
+
+	// The password stays the same, only the version is recorded.
+	for _, u := range unchanged {
+		u.Site.Algorithm = nil
+		sites = mpw.PutSite(sites, u.Site)
+	}
+	if len(unchanged) > 0 {
+		err = writeSites(sites)
+		if err != nil {
+			fmt.Printf("error writing sites: %s\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("\nUpgraded %d sites whose password does not change.\n", len(unchanged))
+	}
+	if len(changed) == 0 {
+		return
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Printf("%d sites need a new password, run mpw upgrade in a terminal to change them.\n", len(changed))
+		os.Exit(1)
+	}
+	for i, u := range changed {
+		fmt.Printf("\n[%d/%d] %s\n", i+1, len(changed), u.Site.Name)
+		fmt.Printf("  Current password (algorithm %d): %s\n", siteAlgorithm(u.Site), u.Current)
+		fmt.Printf("  New password (algorithm %d):     %s\n", mpw.CurrentAlgorithm, u.New)
+		answer, err := input("Changed at the site? [y]es/[s]kip/[q]uit ")
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+		case "q", "quit":
+			return
+		default:
+			continue
+		}
+		// The current password is kept in the previous passwords, like
+		// a rotation that keeps the counter.
+		upgraded := mpw.RotateSite(u.Site, siteCounter(u.Site), time.Now())
+		sites = mpw.PutSite(sites, upgraded)
+		err = writeSites(sites)
+		if err != nil {
+			fmt.Printf("error writing sites: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+}
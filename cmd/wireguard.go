@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+
+	mpw "github.com/emiljoha/mpw-go/internal"
+)
+
+// wireguard prints the WireGuard private key derived for a site, or its
+// public key, base64 encoded as wg genkey and wg pubkey print them.
+func wireguard(args []string) {
+	fs := flag.NewFlagSet("wireguard", flag.ExitOnError)
+	public := fs.Bool("public", false, "Print the public key instead of the private key")
+	counter := fs.Int("c", 0, "Key counter, defaults to the stored key counter")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Println("usage: mpw wireguard [--public] [-c COUNTER] SITE")
+		os.Exit(1)
+	}
+	sites, err := readSites()
+	if err != nil {
+		fmt.Printf("error reading sites: %s\n", err.Error())
+		os.Exit(1)
+	}
+	site, found := mpw.FindSite(sites, fs.Arg(0))
+	if !found {
+		site = mpw.Site{Name: fs.Arg(0)}
+	}
+	if *counter != 0 {
+		site.KeyCounter = *counter
+	}
+	masterKey, err := unlockMasterKey()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	key, err := mpw.WireGuardKey(masterKey, site.Name, siteKeyCounter(site))
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if *public {
+		fmt.Println(base64.StdEncoding.EncodeToString(key.PublicKey().Bytes()))
+		return
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(key.Bytes()))
+}
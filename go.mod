@@ -1,6 +1,6 @@
 module github.com/emiljoha/mpw-go
 
-go 1.19
+go 1.20
 
 require (
 	github.com/rajveermalviya/go-wayland/wayland v0.0.0-20230130181619-0ad78d1310b2
@@ -4,8 +4,10 @@ import (
 	"crypto"
 	"crypto/hmac"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"golang.org/x/crypto/scrypt"
 )
@@ -15,11 +17,131 @@ func Password(fullName, masterPassword, siteName  string, siteCounter int, resul
 	if err != nil {
 		return "", err
 	}
-	site, err := siteKey(siteName, master, uint(siteCounter))
+	return SiteResult(master, siteName, siteCounter, Authentication, "", resultType)
+}
+
+// MasterKey derives the master key once so that it can be reused for
+// several sites, see masterKey.
+func MasterKey(fullName, masterPassword string) ([]byte, error) {
+	return masterKey(masterPassword, fullName)
+}
+
+// SiteResult renders the site key for purpose and context as resultType.
+func SiteResult(masterKey []byte, siteName string, siteCounter int, purpose KeyPurpose, context string, resultType ResultType) (string, error) {
+	return SiteResultForAlgorithm(CurrentAlgorithm, masterKey, siteName, siteCounter, purpose, context, resultType)
+}
+
+// Algorithm versions
+//
+// Earlier versions of the algorithm measured names in characters instead
+// of bytes and misread the site key, and their results differ from those
+// of the current version for some inputs:
+//
+// ´´´
+// 0: LEN( <site name> ) and LEN( <full name> ) count characters, and
+//    site key bytes are read as signed characters byte-swapped into 16-bit
+//    integers when picking the template and the characters
+// 1: LEN( <site name> ) and LEN( <full name> ) count characters
+// 2: LEN( <full name> ) counts characters
+// 3: current version
+// ´´´
+//
+// Passwords of the earlier versions are still in use, so they can still be
+// derived. New passwords always use CurrentAlgorithm.
+const CurrentAlgorithm = 3
+
+// MasterKeyForAlgorithm derives the master key of an algorithm version.
+// It only differs from the current master key for full names with non
+// ASCII characters.
+func MasterKeyForAlgorithm(algorithm int, fullName, masterPassword string) ([]byte, error) {
+	if algorithm < 0 || algorithm > CurrentAlgorithm {
+		return nil, fmt.Errorf("algorithm version %d not found", algorithm)
+	}
+	return masterKeyForAlgorithm(masterPassword, fullName, algorithm)
+}
+
+// MasterKeys derives the master key of every algorithm version, indexed by
+// version. Versions that derive the same key share it, so a full name of
+// ASCII characters costs a single derivation.
+func MasterKeys(fullName, masterPassword string) ([][]byte, error) {
+	keys := make([][]byte, CurrentAlgorithm+1)
+	derived := map[uint32][]byte{}
+	for algorithm := range keys {
+		length := fullNameLength(fullName, algorithm)
+		key, found := derived[length]
+		if !found {
+			var err error
+			key, err = masterKeyForAlgorithm(masterPassword, fullName, algorithm)
+			if err != nil {
+				return nil, err
+			}
+			derived[length] = key
+		}
+		keys[algorithm] = key
+	}
+	return keys, nil
+}
+
+// SiteResultForAlgorithm renders the site key like SiteResult with an
+// algorithm version. masterKey is the master key of that version.
+func SiteResultForAlgorithm(algorithm int, masterKey []byte, siteName string, siteCounter int, purpose KeyPurpose, context string, resultType ResultType) (string, error) {
+	if algorithm < 0 || algorithm > CurrentAlgorithm {
+		return "", fmt.Errorf("algorithm version %d not found", algorithm)
+	}
+	scope, found := scopes[purpose]
+	if !found {
+		return "", fmt.Errorf("key purpose %s not found", purpose)
+	}
+	site, err := siteKeyForAlgorithm(siteName, masterKey, uint(siteCounter), scope, context, algorithm)
 	if err != nil {
 		return "", err
 	}
-	return password(site, resultType)
+	if resultType == Words {
+		return passphrase(site, DefaultPassphraseOptions)
+	}
+	return password(site, resultType, algorithm)
+}
+
+// AlgorithmDifferences lists why the results of an algorithm version for
+// fullName and siteName may differ from those of the current version.
+// Without context, results that it lists nothing for are the same.
+func AlgorithmDifferences(algorithm int, fullName, siteName string) []string {
+	var differences []string
+	if fullNameLength(fullName, algorithm) != fullNameLength(fullName, CurrentAlgorithm) {
+		differences = append(differences, "full name length counted in characters")
+	}
+	if nameLength(siteName, algorithm) != nameLength(siteName, CurrentAlgorithm) {
+		differences = append(differences, "site name length counted in characters")
+	}
+	if algorithm == 0 {
+		differences = append(differences, "site key read as signed characters")
+	}
+	return differences
+}
+
+// fullNameLength is LEN( <full name> ) of an algorithm version.
+func fullNameLength(fullName string, algorithm int) uint32 {
+	if algorithm < 3 {
+		return uint32(utf8.RuneCountInString(fullName))
+	}
+	return uint32(len([]byte(fullName)))
+}
+
+// nameLength is LEN( <site name> ) and LEN( <context> ) of an algorithm
+// version.
+func nameLength(name string, algorithm int) uint32 {
+	if algorithm < 2 {
+		return uint32(utf8.RuneCountInString(name))
+	}
+	return uint32(len([]byte(name)))
+}
+
+// KeyID identifies a master key without revealing it, so that a mistyped
+// master password can be recognized.
+func KeyID(masterKey []byte) string {
+	hash := crypto.SHA256.New()
+	hash.Write(masterKey)
+	return strings.ToUpper(hex.EncodeToString(hash.Sum(nil)))
 }
 
 func Identicon(fullName, masterPassword string, useColor bool) string {
@@ -63,13 +185,42 @@ func Identicon(fullName, masterPassword string, useColor bool) string {
 //  We employ the SCRYPT cryptographic function to derive a 64-byte
 //  cryptographic key from the user’s name and master password using a fixed
 //  set of parameters.
+const (
+	scryptN = 32768
+	scryptR = 8
+	scryptP = 2
+)
+
 func masterKey(masterPassword string, name string) ([]byte, error) {
+	return masterKeyForAlgorithm(masterPassword, name, CurrentAlgorithm)
+}
+
+func masterKeyForAlgorithm(masterPassword string, name string, algorithm int) ([]byte, error) {
 	lengthNameAsBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(lengthNameAsBytes, uint32(len([]byte(name))))
+	binary.BigEndian.PutUint32(lengthNameAsBytes, fullNameLength(name, algorithm))
 	seed := []byte("com.lyndir.masterpassword")
 	seed = append(seed, lengthNameAsBytes...)
 	seed = append(seed, []byte(name)...)
-	return scrypt.Key([]byte(masterPassword), seed, 32768, 8, 2, 64)	
+	return scrypt.Key([]byte(masterPassword), seed, scryptN, scryptR, scryptP, 64)	
+}
+
+// Key purposes
+//
+// A site key is scoped to the purpose its result is used for, so that the
+// login name and the security answers of a site are unrelated to its
+// password.
+type KeyPurpose string
+
+const (
+	Authentication KeyPurpose = "Authentication"
+	Identification KeyPurpose = "Identification"
+	Recovery       KeyPurpose = "Recovery"
+)
+
+var scopes = map[KeyPurpose]string{
+	Authentication: "com.lyndir.masterpassword",
+	Identification: "com.lyndir.masterpassword.login",
+	Recovery:       "com.lyndir.masterpassword.answer",
 }
 
 // Phase 2: Your site key "com.lyndir.masterpassword"
@@ -91,19 +242,33 @@ func masterKey(masterPassword string, name string) ([]byte, error) {
 // siteKey = HMAC-SHA-256( key, seed )
 // key = <master key>
 // seed = scope . LEN(<site name>) . <site name> . <counter>
+//        [. LEN(<context>) . <context>]
 // 
 // We employ the HMAC-SHA-256 cryptographic function to derive a 64-byte
 // cryptographic site key from the from the site name and master key scoped
 // to a given counter value.
-func siteKey(siteName string, masterKey []byte, counter uint) ([]byte, error) {
+//
+// The scope depends on the key purpose and the optional context further
+// scopes the key, e.g. to a single security question.
+func siteKey(siteName string, masterKey []byte, counter uint, scope string, context string) ([]byte, error) {
+	return siteKeyForAlgorithm(siteName, masterKey, counter, scope, context, CurrentAlgorithm)
+}
+
+func siteKeyForAlgorithm(siteName string, masterKey []byte, counter uint, scope string, context string, algorithm int) ([]byte, error) {
 	lengthNameAsBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(lengthNameAsBytes, uint32(len([]byte(siteName))))
+	binary.BigEndian.PutUint32(lengthNameAsBytes, nameLength(siteName, algorithm))
 	counterAsbytes := make([]byte, 4)
 	binary.BigEndian.PutUint32(counterAsbytes, uint32(counter))
-	seed := []byte("com.lyndir.masterpassword")
+	seed := []byte(scope)
 	seed = append(seed, lengthNameAsBytes...)
 	seed = append(seed, []byte(siteName)...)
 	seed = append(seed, counterAsbytes...)
+	if context != "" {
+		lengthContextAsBytes := make([]byte, 4)
+		binary.BigEndian.PutUint32(lengthContextAsBytes, nameLength(context, algorithm))
+		seed = append(seed, lengthContextAsBytes...)
+		seed = append(seed, []byte(context)...)
+	}
 
 	hash := hmac.New(crypto.SHA256.New, masterKey)
 	_ , err := hash.Write(seed)
@@ -215,26 +380,49 @@ var templateCharsDictionary map[templaceCharacter][]string = map[templaceCharact
 // 
 // This password is then used to authenticate the user for his account at
 // this site.
-func password(siteKey []byte, class ResultType) (string, error) {
+func password(siteKey []byte, class ResultType, algorithm int) (string, error) {
+	explanation, err := explainPassword(siteKey, class, algorithm)
+	if err != nil {
+		return "", err
+	}
+	return explanation.Password, nil
+}
+
+// explainPassword renders the site key like password and records every
+// choice it makes on the way.
+func explainPassword(siteKey []byte, class ResultType, algorithm int) (Explanation, error) {
 	templates, found := TemplateDictionary[class]
 	if !found {
-		return "", fmt.Errorf("class %s not found", class)
+		return Explanation{}, fmt.Errorf("class %s not found", class)
 	}
 	if len(templates) > 255 {
-		return "", fmt.Errorf("template class %s to large, len %d but max 255", class, len(templates))
+		return Explanation{}, fmt.Errorf("template class %s to large, len %d but max 255", class, len(templates))
 	}
-	template := templates[uint8(siteKey[0]) % uint8(len(templates))]
-	if len(template) > len(siteKey) {
-		return "", fmt.Errorf("template %s to large, len %d but max 255", class, len(template))
+	templateIndex := siteKeyValue(siteKey, 0, algorithm) % len(templates)
+	template := templates[templateIndex]
+	if len(template) >= len(siteKey) {
+		return Explanation{}, fmt.Errorf("template %s to large, len %d but max %d", class, len(template), len(siteKey)-1)
+	}
+	explanation := Explanation{
+		Type:          class,
+		TemplateIndex: templateIndex,
+		Templates:     len(templates),
+		Template:      string(template),
 	}
 	password := make([]string, 0)
 	for i, tc := range template {
 		passChars := templateCharsDictionary[tc]
-		password = append(password,
-			passChars[uint8(siteKey[i+1]) % uint8(len(passChars))],
-		)
+		passChar := passChars[siteKeyValue(siteKey, i+1, algorithm) % len(passChars)]
+		password = append(password, passChar)
+		explanation.Characters = append(explanation.Characters, CharacterExplanation{
+			Character:    passChar,
+			Class:        rune(tc),
+			AlphabetSize: len(passChars),
+			KeyByte:      i + 1,
+		})
 	}
-	return strings.Join(password, ""), nil
+	explanation.Password = strings.Join(password, "")
+	return explanation, nil
 }
 
 var leftArms  = []string{"╔", "╚", "╰", "═"}
@@ -259,3 +447,13 @@ var colorCodes = map[color]colorCode {
 	}
 var colors = []color{"Red", "Green", "Yellow", "Blue", "Magenta", "Cyan", "White"}
 
+// siteKeyValue is the value of the site key byte at i that picks a
+// template or character. Algorithm 0 read the byte as a signed character
+// and byte-swapped it into a 16-bit integer.
+func siteKeyValue(siteKey []byte, i int, algorithm int) int {
+	if algorithm == 0 {
+		v := uint16(int16(int8(siteKey[i])))
+		return int(v<<8 | v>>8)
+	}
+	return int(siteKey[i])
+}
@@ -13,7 +13,7 @@ func TestPassword(t *testing.T) {
 	type Test struct{
 		Id TestID `xml:"id,attr"`
 		Parent string `xml:"parent,attr"`
-		Algorithm int `xml:"algorithm"`
+		Algorithm *int `xml:"algorithm"`
 		FullName string `xml:"fullName"`
 		MasterPassword string `xml:"masterPassword"`
 		KeyID string `xml:"keyID"`
@@ -44,7 +44,7 @@ func TestPassword(t *testing.T) {
 		}
 		parent, found := tests[TestID(test.Parent)]
 		require.True(t, found, test.Parent)
-		if test.Algorithm == 0 {
+		if test.Algorithm == nil {
 			test.Algorithm = parent.Algorithm
 		}
 		if test.FullName == "" {
@@ -80,7 +80,7 @@ func TestPassword(t *testing.T) {
 		tests[test.Id] = test
 	}
 	for id, test := range tests {
-		if test.Algorithm != 3 {
+		if *test.Algorithm != 3 {
 			continue
 		}
 		if test.KeyContext != "" {
@@ -97,6 +97,73 @@ func TestPassword(t *testing.T) {
 			require.Equal(t, test.Result, passwd)
 		})
 	}
+	for id, test := range tests {
+		if *test.Algorithm != 3 {
+			continue
+		}
+		t.Run(string(id)+"_SiteResult", func(t *testing.T) {
+			key, err := MasterKey(test.FullName, test.MasterPassword)
+			require.NoError(t, err)
+			require.Equal(t, test.KeyID, KeyID(key))
+			require.Equal(t, test.Identicon, Identicon(test.FullName, test.MasterPassword, false))
+			result, err := SiteResult(
+				key, test.SiteName, test.SiteCounter, KeyPurpose(test.KeyPurpose), test.KeyContext, test.ResultType,
+			)
+			require.NoError(t, err)
+			require.Equal(t, test.Result, result)
+		})
+	}
+	for id, test := range tests {
+		if *test.Algorithm < 0 {
+			continue
+		}
+		t.Run(string(id)+"_SiteResultForAlgorithm", func(t *testing.T) {
+			key, err := MasterKeyForAlgorithm(*test.Algorithm, test.FullName, test.MasterPassword)
+			require.NoError(t, err)
+			result, err := SiteResultForAlgorithm(
+				*test.Algorithm, key, test.SiteName, test.SiteCounter, KeyPurpose(test.KeyPurpose), test.KeyContext, test.ResultType,
+			)
+			require.NoError(t, err)
+			require.Equal(t, test.Result, result)
+		})
+	}
+}
+
+func TestMasterKeys(t *testing.T) {
+	for _, fullName := range []string{"Robert Lee Mitchell", "⛄"} {
+		keys, err := MasterKeys(fullName, "banana colored duckling")
+		require.NoError(t, err)
+		require.Len(t, keys, CurrentAlgorithm+1)
+		for algorithm, key := range keys {
+			expected, err := MasterKeyForAlgorithm(algorithm, fullName, "banana colored duckling")
+			require.NoError(t, err)
+			require.Equal(t, expected, key)
+		}
+	}
+	_, err := MasterKeyForAlgorithm(CurrentAlgorithm+1, "Robert Lee Mitchell", "banana colored duckling")
+	require.Error(t, err)
 }
 
+func TestAlgorithmDifferences(t *testing.T) {
+	require.Empty(t, AlgorithmDifferences(CurrentAlgorithm, "⛄", "⛄.example.com"))
+	require.Empty(t, AlgorithmDifferences(1, "Robert Lee Mitchell", "masterpasswordapp.com"))
+	require.Len(t, AlgorithmDifferences(2, "⛄", "⛄.example.com"), 1)
+	require.Len(t, AlgorithmDifferences(1, "Robert Lee Mitchell", "⛄.example.com"), 1)
+	require.Len(t, AlgorithmDifferences(0, "Robert Lee Mitchell", "masterpasswordapp.com"), 1)
 
+	keys, err := MasterKeys("Robert Lee Mitchell", "banana colored duckling")
+	require.NoError(t, err)
+	for algorithm := 0; algorithm < CurrentAlgorithm; algorithm++ {
+		for _, siteName := range []string{"masterpasswordapp.com", "⛄.example.com"} {
+			result, err := SiteResultForAlgorithm(algorithm, keys[algorithm], siteName, 1, Authentication, "", "Long")
+			require.NoError(t, err)
+			current, err := SiteResult(keys[CurrentAlgorithm], siteName, 1, Authentication, "", "Long")
+			require.NoError(t, err)
+			if len(AlgorithmDifferences(algorithm, "Robert Lee Mitchell", siteName)) == 0 {
+				require.Equal(t, current, result, algorithm)
+			} else {
+				require.NotEqual(t, current, result, algorithm)
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package mpw
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Encrypted files
+//
+// Files that hold secrets are encrypted with AES-256-GCM under a key derived
+// from the master key in a scope of their own. The header names the
+// format version and the key ID of the master key, so that a file
+// encrypted under another master key is told apart from a damaged one,
+// and is authenticated along with the contents.
+//
+// ´´´
+// file = "mpw-go encrypted" . version . keyID . nonce . ciphertext
+// key = derivedKey( <master key>, scope, "", 1, 32 )
+// ciphertext = AES-256-GCM( key, nonce, contents, "mpw-go encrypted" . version . keyID )
+// ´´´
+const (
+	MigrationScope = "com.github.emiljoha.mpw-go.migration"
+	SitesScope     = "com.github.emiljoha.mpw-go.sites"
+)
+
+const (
+	encryptedMagic   = "mpw-go encrypted"
+	encryptedVersion = 1
+)
+
+// ErrWrongMasterKey is returned for files encrypted under another master
+// key.
+var ErrWrongMasterKey = errors.New("encrypted under another master key")
+
+// Encrypt encrypts contents under the master key in scope.
+func Encrypt(masterKey []byte, scope string, contents []byte) ([]byte, error) {
+	aead, err := fileCipher(masterKey, scope)
+	if err != nil {
+		return nil, err
+	}
+	header, err := encryptedHeader(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	file := append(append([]byte(nil), header...), nonce...)
+	return aead.Seal(file, nonce, contents, header), nil
+}
+
+// Encrypted reports whether file was encrypted by Encrypt.
+func Encrypted(file []byte) bool {
+	return bytes.HasPrefix(file, []byte(encryptedMagic))
+}
+
+// Decrypt decrypts a file that Encrypt encrypted under the master key in
+// scope.
+func Decrypt(masterKey []byte, scope string, file []byte) ([]byte, error) {
+	aead, err := fileCipher(masterKey, scope)
+	if err != nil {
+		return nil, err
+	}
+	header, err := encryptedHeader(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if !Encrypted(file) || len(file) < len(encryptedMagic)+1 {
+		return nil, errors.New("not an encrypted file")
+	}
+	if version := file[len(encryptedMagic)]; version != encryptedVersion {
+		return nil, fmt.Errorf("encrypted file version %d not supported", version)
+	}
+	if len(file) < len(header)+aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("encrypted file truncated")
+	}
+	if !bytes.Equal(file[:len(header)], header) {
+		return nil, fmt.Errorf("%w %X", ErrWrongMasterKey, file[len(encryptedMagic)+1:len(header)])
+	}
+	nonce := file[len(header) : len(header)+aead.NonceSize()]
+	contents, err := aead.Open(nil, nonce, file[len(header)+aead.NonceSize():], header)
+	if err != nil {
+		return nil, errors.New("encrypted file damaged")
+	}
+	return contents, nil
+}
+
+func fileCipher(masterKey []byte, scope string) (cipher.AEAD, error) {
+	key, err := DerivedKey(masterKey, scope, "", 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptedHeader(masterKey []byte) ([]byte, error) {
+	keyID, err := hex.DecodeString(KeyID(masterKey))
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte(encryptedMagic), encryptedVersion)
+	return append(header, keyID...), nil
+}
@@ -0,0 +1,42 @@
+package mpw
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncrypt(t *testing.T) {
+	master := bytes.Repeat([]byte{1}, 64)
+	other := bytes.Repeat([]byte{2}, 64)
+	contents := []byte("old and new passwords")
+
+	file, err := Encrypt(master, MigrationScope, contents)
+	require.NoError(t, err)
+	require.NotContains(t, string(file), string(contents))
+	decrypted, err := Decrypt(master, MigrationScope, file)
+	require.NoError(t, err)
+	require.Equal(t, contents, decrypted)
+
+	again, err := Encrypt(master, MigrationScope, contents)
+	require.NoError(t, err)
+	require.NotEqual(t, file, again)
+
+	_, err = Decrypt(other, MigrationScope, file)
+	require.True(t, errors.Is(err, ErrWrongMasterKey))
+	_, err = Decrypt(master, KeyScope, file)
+	require.Error(t, err)
+
+	for i := range file {
+		tampered := append([]byte(nil), file...)
+		tampered[i] ^= 0x80
+		_, err = Decrypt(master, MigrationScope, tampered)
+		require.Error(t, err, i)
+	}
+	_, err = Decrypt(master, MigrationScope, file[:len(file)-1])
+	require.Error(t, err)
+	_, err = Decrypt(master, MigrationScope, []byte("plain text"))
+	require.Error(t, err)
+}
@@ -0,0 +1,337 @@
+package mpw
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"unicode"
+)
+
+// Strength
+//
+// Every password of a result type is a function of the site key bytes, so
+// its strength is known exactly: the first byte picks the template with
+// probability (number of byte values b with b % LEN( templates ) = i) / 256
+// and every following byte picks a character of its class the same way.
+// When the number of templates or class characters does not divide 256,
+// the first templates or characters are slightly more likely than the
+// others and the entropy is a little below log2 of the number of
+// passwords.
+//
+// Templates of the same length may produce the same password, as the two
+// Maximum templates do, which makes the template choice partly invisible in
+// the password. The entropy accounts for that by subtracting what remains
+// unknown about the template once the password is known:
+//
+// ´´´
+// H( password ) = H( template ) + H( password | template ) - H( template | password )
+// ´´´
+type Strength struct {
+	Type      ResultType
+	MinLength int
+	MaxLength int
+	// Classes are the kinds of characters that occur: upper, lower,
+	// digit, symbol and space.
+	Classes []string
+	// Entropy is the Shannon entropy of the passwords in bits.
+	Entropy float64
+	// MinEntropy is -log2 of the probability of the most likely password,
+	// the strength against an attacker who guesses it first.
+	MinEntropy float64
+}
+
+// maxStrengthCombinations bounds the enumeration of ambiguous templates.
+const maxStrengthCombinations = 10000000
+
+// ResultTypeStrength computes the strength of the passwords of resultType.
+// The Words type is computed for its default options.
+func ResultTypeStrength(resultType ResultType) (Strength, error) {
+	if resultType == Words {
+		options := DefaultPassphraseOptions
+		bits := options.Entropy()
+		list := wordlist()
+		minLength, maxLength := len(list[0]), len(list[0])
+		for _, word := range list {
+			if len(word) < minLength {
+				minLength = len(word)
+			}
+			if len(word) > maxLength {
+				maxLength = len(word)
+			}
+		}
+		separators := (options.Words - 1) * len(*options.Separator)
+		return Strength{
+			Type:       Words,
+			MinLength:  options.Words*minLength + separators,
+			MaxLength:  options.Words*maxLength + separators,
+			Classes:    passphraseClasses(options),
+			Entropy:    bits,
+			MinEntropy: bits,
+		}, nil
+	}
+	templates, found := TemplateDictionary[resultType]
+	if !found {
+		return Strength{}, fmt.Errorf("class %s not found", resultType)
+	}
+	strength := Strength{Type: resultType, MinLength: len(templates[0]), MaxLength: len(templates[0])}
+	templateProbabilities := byteModuloProbabilities(len(templates))
+	classes := map[string]bool{}
+	positions := make([][]map[string]float64, len(templates))
+	for t, template := range templates {
+		if len(template) < strength.MinLength {
+			strength.MinLength = len(template)
+		}
+		if len(template) > strength.MaxLength {
+			strength.MaxLength = len(template)
+		}
+		for _, tc := range template {
+			chars := templateCharsDictionary[tc]
+			distribution := map[string]float64{}
+			for i, p := range byteModuloProbabilities(len(chars)) {
+				distribution[chars[i]] += p
+				classes[characterClass(chars[i])] = true
+			}
+			positions[t] = append(positions[t], distribution)
+			strength.Entropy += templateProbabilities[t] * shannon(distribution)
+		}
+	}
+	strength.Entropy += shannonSlice(templateProbabilities)
+	strength.Classes = orderedClasses(classes)
+
+	// Templates of different lengths never produce the same password.
+	byLength := map[int][]int{}
+	for t, template := range templates {
+		byLength[len(template)] = append(byLength[len(template)], t)
+	}
+	maxProbability := 0.0
+	for _, group := range byLength {
+		ambiguity, groupMax, err := templateAmbiguity(group, templateProbabilities, positions)
+		if err != nil {
+			return Strength{}, err
+		}
+		strength.Entropy -= ambiguity
+		maxProbability = math.Max(maxProbability, groupMax)
+	}
+	strength.MinEntropy = -math.Log2(maxProbability)
+	return strength, nil
+}
+
+// templateAmbiguity computes the part of H( template | password ) that is
+// due to the templates in group, which all have the same length, and the
+// probability of the most likely password of the group.
+//
+// Positions where all templates of the group pick characters the same way
+// say nothing about the template and are left out. At the other positions,
+// characters that are equally likely under every template are
+// interchangeable, so only one combination of such character groups per
+// position needs to be looked at, and only as long as more than one
+// template could have produced it.
+func templateAmbiguity(group []int, templateProbabilities []float64, positions [][]map[string]float64) (float64, float64, error) {
+	length := len(positions[group[0]])
+	type characterGroup struct {
+		count         int
+		probabilities []float64 // per template in group
+	}
+	var differing [][]characterGroup
+	sharedMax := 1.0
+	for i := 0; i < length; i++ {
+		same := true
+		for _, t := range group[1:] {
+			same = same && equalDistributions(positions[group[0]][i], positions[t][i])
+		}
+		if same {
+			sharedMax *= maxValue(positions[group[0]][i])
+			continue
+		}
+		characters := map[string]bool{}
+		for _, t := range group {
+			for c := range positions[t][i] {
+				characters[c] = true
+			}
+		}
+		groups := map[string]*characterGroup{}
+		var keys []string
+		for c := range characters {
+			probabilities := make([]float64, len(group))
+			for j, t := range group {
+				probabilities[j] = positions[t][i][c]
+			}
+			key := fmt.Sprint(probabilities)
+			if groups[key] == nil {
+				groups[key] = &characterGroup{probabilities: probabilities}
+				keys = append(keys, key)
+			}
+			groups[key].count++
+		}
+		sort.Strings(keys)
+		var position []characterGroup
+		for _, key := range keys {
+			position = append(position, *groups[key])
+		}
+		differing = append(differing, position)
+	}
+
+	ambiguity := 0.0
+	maxProbability := 0.0
+	visited := 0
+	var walk func(i int, weight float64, joint []float64) error
+	walk = func(i int, weight float64, joint []float64) error {
+		visited++
+		if visited > maxStrengthCombinations {
+			return errors.New("templates too ambiguous to compute the entropy")
+		}
+		total := 0.0
+		possible := 0
+		for _, p := range joint {
+			total += p
+			if p > 0 {
+				possible++
+			}
+		}
+		if possible == 0 {
+			return nil
+		}
+		if possible == 1 || i == len(differing) {
+			// Once a single template remains, the rest of the password
+			// tells nothing more about it.
+			if possible > 1 {
+				posterior := make([]float64, len(joint))
+				for j, p := range joint {
+					posterior[j] = p / total
+				}
+				ambiguity += weight * total * shannonSlice(posterior)
+			}
+			for j, p := range joint {
+				if p == 0 {
+					continue
+				}
+				for _, position := range differing[i:] {
+					best := 0.0
+					for _, characterGroup := range position {
+						best = math.Max(best, characterGroup.probabilities[j])
+					}
+					p *= best
+				}
+				maxProbability = math.Max(maxProbability, p*sharedMax)
+			}
+			return nil
+		}
+		for _, characterGroup := range differing[i] {
+			next := make([]float64, len(joint))
+			for j, p := range joint {
+				next[j] = p * characterGroup.probabilities[j]
+			}
+			err := walk(i+1, weight*float64(characterGroup.count), next)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	joint := make([]float64, len(group))
+	for j, t := range group {
+		joint[j] = templateProbabilities[t]
+	}
+	err := walk(0, 1, joint)
+	if err != nil {
+		return 0, 0, err
+	}
+	return ambiguity, maxProbability, nil
+}
+
+// byteModuloProbabilities are the probabilities of the results of a
+// uniformly random byte modulo n.
+func byteModuloProbabilities(n int) []float64 {
+	probabilities := make([]float64, n)
+	for b := 0; b < 256; b++ {
+		probabilities[b%n] += 1.0 / 256
+	}
+	return probabilities
+}
+
+// passphraseClasses are the classes of the characters that occur in
+// passphrases with options, in the words of the wordlist as capitalized and
+// in the separator.
+func passphraseClasses(options PassphraseOptions) []string {
+	options = options.withDefaults()
+	classes := map[string]bool{}
+	for _, word := range wordlist() {
+		for i, r := range word {
+			if options.Capitalization == Uppercase || options.Capitalization == Titlecase && i == 0 {
+				r = unicode.ToUpper(r)
+			}
+			classes[characterClass(string(r))] = true
+		}
+	}
+	for _, r := range *options.Separator {
+		classes[characterClass(string(r))] = true
+	}
+	return orderedClasses(classes)
+}
+
+// orderedClasses lists the classes in the order of Strength.Classes.
+func orderedClasses(classes map[string]bool) []string {
+	var ordered []string
+	for _, class := range []string{"upper", "lower", "digit", "symbol", "space"} {
+		if classes[class] {
+			ordered = append(ordered, class)
+		}
+	}
+	return ordered
+}
+
+func characterClass(c string) string {
+	r := []rune(c)[0]
+	switch {
+	case unicode.IsUpper(r):
+		return "upper"
+	case unicode.IsLower(r):
+		return "lower"
+	case unicode.IsDigit(r):
+		return "digit"
+	case unicode.IsSpace(r):
+		return "space"
+	}
+	return "symbol"
+}
+
+func shannon(distribution map[string]float64) float64 {
+	bits := 0.0
+	for _, p := range distribution {
+		if p > 0 {
+			bits -= p * math.Log2(p)
+		}
+	}
+	return bits
+}
+
+func shannonSlice(distribution []float64) float64 {
+	bits := 0.0
+	for _, p := range distribution {
+		if p > 0 {
+			bits -= p * math.Log2(p)
+		}
+	}
+	return bits
+}
+
+func equalDistributions(a, b map[string]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for c, p := range a {
+		if b[c] != p {
+			return false
+		}
+	}
+	return true
+}
+
+func maxValue(distribution map[string]float64) float64 {
+	max := 0.0
+	for _, p := range distribution {
+		max = math.Max(max, p)
+	}
+	return max
+}
@@ -0,0 +1,58 @@
+package mpw
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultTypeStrength(t *testing.T) {
+	// 256 % 10 = 6, so the digits 0 to 5 are picked with 26/256 and the
+	// others with 25/256.
+	digit := -(6*26.0/256*math.Log2(26.0/256) + 4*25.0/256*math.Log2(25.0/256))
+	pin, err := ResultTypeStrength("PIN")
+	require.NoError(t, err)
+	require.InDelta(t, 4*digit, pin.Entropy, 1e-9)
+	require.InDelta(t, -4*math.Log2(26.0/256), pin.MinEntropy, 1e-9)
+	require.Equal(t, []string{"digit"}, pin.Classes)
+	require.Equal(t, 4, pin.MinLength)
+	require.Equal(t, 4, pin.MaxLength)
+
+	for resultType := range TemplateDictionary {
+		strength, err := ResultTypeStrength(resultType)
+		require.NoError(t, err)
+		require.LessOrEqual(t, strength.MinEntropy, strength.Entropy, resultType)
+		require.Greater(t, strength.MinEntropy, 0.0, resultType)
+	}
+
+	// The two Maximum templates produce the same password when the first
+	// one picks a digit at the end and the second one at the start, so
+	// the entropy is below that of an unambiguous template choice.
+	maximum, err := ResultTypeStrength("Maximum")
+	require.NoError(t, err)
+	require.Less(t, maximum.Entropy, 1+maximumUnambiguous())
+	require.Equal(t, []string{"upper", "lower", "digit", "symbol"}, maximum.Classes)
+
+	words, err := ResultTypeStrength(Words)
+	require.NoError(t, err)
+	require.InDelta(t, 6*math.Log2(7776), words.Entropy, 1e-9)
+	require.Equal(t, words.Entropy, words.MinEntropy)
+	// drop-down, felt-tip, t-shirt and yo-yo are hyphenated.
+	require.Equal(t, []string{"lower", "symbol", "space"}, words.Classes)
+	joined := ""
+	require.Equal(t, []string{"upper", "lower", "symbol"}, passphraseClasses(PassphraseOptions{Separator: &joined, Capitalization: Titlecase}))
+
+	_, err = ResultTypeStrength("Unknown")
+	require.Error(t, err)
+}
+
+// maximumUnambiguous is H( password | template ) of the Maximum templates.
+func maximumUnambiguous() float64 {
+	bits := 0.0
+	for _, tc := range TemplateDictionary["Maximum"][0] {
+		chars := templateCharsDictionary[tc]
+		bits += shannonSlice(byteModuloProbabilities(len(chars)))
+	}
+	return bits
+}
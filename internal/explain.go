@@ -0,0 +1,64 @@
+package mpw
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Explanation tells how a site password was rendered from its site key,
+// without revealing the key: which template its first byte picked and
+// which byte picked each character.
+type Explanation struct {
+	Type          ResultType
+	TemplateIndex int
+	// Templates is the number of templates of the type.
+	Templates int
+	// Template is the pattern of template characters, e.g. CvcvnoCvcvCvcv.
+	Template   string
+	Characters []CharacterExplanation
+	Password   string
+}
+
+// CharacterExplanation tells how a character of a site password was
+// picked: the site key byte at KeyByte modulo AlphabetSize indexes the
+// characters of Class.
+type CharacterExplanation struct {
+	Character    string
+	Class        rune
+	AlphabetSize int
+	KeyByte      int
+}
+
+// TemplateClassNames describe the template characters.
+var TemplateClassNames = map[rune]string{
+	'V': "upper case vowel",
+	'C': "upper case consonant",
+	'v': "lower case vowel",
+	'c': "lower case consonant",
+	'A': "upper case letter",
+	'a': "letter",
+	'n': "digit",
+	'o': "symbol",
+	'x': "letter, digit or symbol",
+	' ': "space",
+}
+
+// Explain derives the site password like SiteResultForAlgorithm and
+// explains how it was rendered.
+func Explain(algorithm int, masterKey []byte, siteName string, siteCounter int, purpose KeyPurpose, context string, resultType ResultType) (Explanation, error) {
+	if algorithm < 0 || algorithm > CurrentAlgorithm {
+		return Explanation{}, fmt.Errorf("algorithm version %d not found", algorithm)
+	}
+	if resultType == Words {
+		return Explanation{}, errors.New("passphrases of the Words type have no template")
+	}
+	scope, found := scopes[purpose]
+	if !found {
+		return Explanation{}, fmt.Errorf("key purpose %s not found", purpose)
+	}
+	site, err := siteKeyForAlgorithm(siteName, masterKey, uint(siteCounter), scope, context, algorithm)
+	if err != nil {
+		return Explanation{}, err
+	}
+	return explainPassword(site, resultType, algorithm)
+}
@@ -0,0 +1,44 @@
+package mpw
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	key, err := MasterKey("Robert Lee Mitchell", "banana colored duckling")
+	require.NoError(t, err)
+	explanation, err := Explain(CurrentAlgorithm, key, "masterpasswordapp.com", 1, Authentication, "", "Long")
+	require.NoError(t, err)
+	require.Equal(t, "Jejr5[RepuSosp", explanation.Password)
+	require.Equal(t, 21, explanation.Templates)
+	require.Equal(t, string(TemplateDictionary["Long"][explanation.TemplateIndex]), explanation.Template)
+	require.Equal(t, "CvccnoCvcvCvcc", explanation.Template)
+
+	var characters []string
+	for i, c := range explanation.Characters {
+		require.Equal(t, rune(explanation.Template[i]), c.Class)
+		require.Equal(t, i+1, c.KeyByte)
+		require.Len(t, templateCharsDictionary[templaceCharacter(c.Class)], c.AlphabetSize)
+		require.Contains(t, TemplateClassNames, c.Class)
+		characters = append(characters, c.Character)
+	}
+	require.Equal(t, explanation.Password, strings.Join(characters, ""))
+
+	_, err = Explain(CurrentAlgorithm, key, "masterpasswordapp.com", 1, Authentication, "", Words)
+	require.Error(t, err)
+}
+
+func TestExplainAlgorithm(t *testing.T) {
+	// The v2_mb_fullName case of testcases.xml.
+	key, err := MasterKeyForAlgorithm(2, "⛄", "banana colored duckling")
+	require.NoError(t, err)
+	explanation, err := Explain(2, key, "masterpasswordapp.com", 1, Authentication, "", "Long")
+	require.NoError(t, err)
+	require.Equal(t, "WaqoGuho2[Xaxw", explanation.Password)
+
+	_, err = Explain(CurrentAlgorithm+1, key, "masterpasswordapp.com", 1, Authentication, "", "Long")
+	require.Error(t, err)
+}
@@ -0,0 +1,154 @@
+package mpw
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// Breached password lists
+//
+// Have I Been Pwned publishes the passwords of known breaches as lists of
+// their hashes, one per line, with the number of times each was seen:
+//
+// ´´´
+// line = HEX( hash ) . ":" . count
+// hash = SHA-1( <password> ) | MD4( UTF-16LE( <password> ) )
+// ´´´
+//
+// The SHA-1 list is tens of gigabytes, so the list ordered by hash is
+// binary searched in place instead of being read.
+type HashList struct {
+	file *os.File
+	size int64
+	// ntlm is set for lists of NTLM hashes, which are shorter than SHA-1.
+	ntlm bool
+}
+
+// OpenHashList opens a list of SHA-1 or NTLM hashes ordered by hash.
+func OpenHashList(path string) (*HashList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	l := &HashList{file: f, size: info.Size()}
+	first, _, _, err := l.lineAt(0)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	hash, _, _ := strings.Cut(first, ":")
+	switch len(hash) {
+	case 2 * sha1.Size:
+	case 2 * 16:
+		l.ntlm = true
+	default:
+		f.Close()
+		return nil, fmt.Errorf("%s is not a list of SHA-1 or NTLM hashes", path)
+	}
+	return l, nil
+}
+
+// Close closes the file of the list.
+func (l *HashList) Close() error {
+	return l.file.Close()
+}
+
+// NTLM reports whether the list holds NTLM hashes rather than SHA-1.
+func (l *HashList) NTLM() bool {
+	return l.ntlm
+}
+
+// Count looks up password in the list and returns how often it was seen in
+// breaches, 0 if it is not listed.
+func (l *HashList) Count(password string) (int, error) {
+	var hash string
+	if l.ntlm {
+		hash = ntlmHash(password)
+	} else {
+		sum := sha1.Sum([]byte(password))
+		hash = strings.ToUpper(hex.EncodeToString(sum[:]))
+	}
+
+	// A line of hash, if listed, starts between lo and hi.
+	lo, hi := int64(0), l.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		line, start, next, err := l.lineAt(mid)
+		if err != nil {
+			return 0, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+		listed, count, _ := strings.Cut(line, ":")
+		switch listed = strings.ToUpper(listed); {
+		case listed == hash:
+			n, err := strconv.Atoi(strings.TrimSpace(count))
+			if err != nil {
+				return 0, fmt.Errorf("count of %s not valid: %w", hash, err)
+			}
+			return n, nil
+		case listed < hash:
+			lo = next
+		default:
+			hi = start
+		}
+	}
+	return 0, nil
+}
+
+// lineAt returns the first line that starts at or after offset without
+// its line break, where it starts and where the next line starts. At the
+// end of the list the line is empty and starts at its size.
+func (l *HashList) lineAt(offset int64) (string, int64, int64, error) {
+	start := offset
+	if offset > 0 {
+		start = offset - 1
+	}
+	r := bufio.NewReaderSize(io.NewSectionReader(l.file, start, l.size-start), 128)
+	if offset > 0 {
+		skipped, err := r.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			return "", l.size, l.size, nil
+		}
+		if err != nil {
+			return "", 0, 0, err
+		}
+		start += int64(len(skipped))
+	}
+	line, err := r.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", 0, 0, err
+	}
+	next := start + int64(len(line))
+	// The downloaded lists end their lines with "\r\n".
+	return strings.TrimRight(line, "\r\n"), start, next, nil
+}
+
+// ntlmHash is the NTLM hash of password in upper case hex.
+func ntlmHash(password string) string {
+	var utf16le []byte
+	for _, unit := range utf16.Encode([]rune(password)) {
+		utf16le = binary.LittleEndian.AppendUint16(utf16le, unit)
+	}
+	hash := md4.New()
+	hash.Write(utf16le)
+	return strings.ToUpper(hex.EncodeToString(hash.Sum(nil)))
+}
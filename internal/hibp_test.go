@@ -0,0 +1,79 @@
+package mpw
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/md4"
+)
+
+func TestMD4(t *testing.T) {
+	// RFC 1320, A.5
+	for input, expected := range map[string]string{
+		"":               "31d6cfe0d16ae931b73c59d7e0c089c0",
+		"a":              "bde52cb31de33e46245e05fbdbd6fb24",
+		"abc":            "a448017aaf21d8525fc10ae87aa6729d",
+		"message digest": "d9130a8164549fe818874806e1c7014b",
+		"12345678901234567890123456789012345678901234567890123456789012345678901234567890": "e33b4ddc9c38f2199c3e7b164fcc0536",
+	} {
+		hash := md4.New()
+		hash.Write([]byte(input))
+		require.Equal(t, expected, hex.EncodeToString(hash.Sum(nil)), input)
+	}
+	require.Equal(t, "8846F7EAEE8FB117AD06BDD830B7586C", ntlmHash("password"))
+}
+
+func TestHashList(t *testing.T) {
+	var passwords []string
+	for i := 0; i < 500; i++ {
+		passwords = append(passwords, fmt.Sprintf("password%d", i))
+	}
+	for _, format := range []struct {
+		name    string
+		newline string
+		hash    func(string) string
+	}{
+		{"sha1", "\r\n", func(password string) string {
+			sum := sha1.Sum([]byte(password))
+			return strings.ToUpper(hex.EncodeToString(sum[:]))
+		}},
+		{"ntlm", "\n", ntlmHash},
+	} {
+		t.Run(format.name, func(t *testing.T) {
+			// Every other password is listed, seen as often as its index.
+			var lines []string
+			for i := 0; i < len(passwords); i += 2 {
+				lines = append(lines, fmt.Sprintf("%s:%d", format.hash(passwords[i]), i+1))
+			}
+			sort.Strings(lines)
+			path := filepath.Join(t.TempDir(), "pwned.txt")
+			require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, format.newline)+format.newline), 0600))
+
+			list, err := OpenHashList(path)
+			require.NoError(t, err)
+			defer list.Close()
+			require.Equal(t, format.name == "ntlm", list.NTLM())
+			for i, password := range passwords {
+				count, err := list.Count(password)
+				require.NoError(t, err)
+				if i%2 == 0 {
+					require.Equal(t, i+1, count, password)
+				} else {
+					require.Zero(t, count, password)
+				}
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "other.txt")
+	require.NoError(t, os.WriteFile(path, []byte("not a hash list\n"), 0600))
+	_, err := OpenHashList(path)
+	require.Error(t, err)
+}
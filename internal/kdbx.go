@@ -0,0 +1,319 @@
+package mpw
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// KeePass databases
+//
+// WriteKDBX writes vault entries as a KeePass database in the KDBX 4
+// format, protected by a password of its own:
+//
+// ´´´
+// file = header . SHA-256( header ) . HMAC-SHA-256( blockKey( 2^64-1 ), header ) . blocks
+// compositeKey = SHA-256( SHA-256( <password> ) )
+// transformedKey = SHA-256( AES-256-ECB^rounds( seed, compositeKey ) )
+// key = SHA-256( masterSeed . transformedKey )
+// blockKey( i ) = SHA-512( i . SHA-512( masterSeed . transformedKey . 1 ) )
+// blocks = ( HMAC-SHA-256( blockKey( i ), i . size . data ) . size . data )*
+// data = AES-256-CBC( key, IV, GZIP( innerHeader . XML ) )
+// ´´´
+//
+// Passwords in the XML are further XORed with ChaCha20 keyed by the inner
+// header, as KeePass protects them in memory.
+
+// kdbxRounds is the number of AES-KDF rounds of exported databases.
+const kdbxRounds = 2000000
+
+var (
+	kdbxSignature = []byte{0x03, 0xd9, 0xa2, 0x9a, 0x67, 0xfb, 0x4b, 0xb5}
+	kdbxVersion   = []byte{0x00, 0x00, 0x04, 0x00}
+	kdbxAES256    = []byte{0x31, 0xc1, 0xf2, 0xe6, 0xbf, 0x71, 0x43, 0x50, 0xbe, 0x58, 0x05, 0x21, 0x6a, 0xfc, 0x5a, 0xff}
+	kdbxAESKDF    = []byte{0xc9, 0xd9, 0xf3, 0x9a, 0x62, 0x8a, 0x44, 0x60, 0xbf, 0x74, 0x0d, 0x08, 0xc1, 0x8a, 0x4f, 0xea}
+)
+
+const (
+	kdbxEndOfHeader     = 0
+	kdbxCipherID        = 2
+	kdbxCompression     = 3
+	kdbxMasterSeed      = 4
+	kdbxEncryptionIV    = 7
+	kdbxKdfParameters   = 11
+	kdbxInnerStreamID   = 1
+	kdbxInnerStreamKey  = 2
+	kdbxInnerChaCha20   = 3
+	kdbxBlockSize       = 1 << 20
+	kdbxGzip            = 1
+	kdbxVariantVersion  = 0x0100
+	kdbxVariantUInt64   = 0x05
+	kdbxVariantBytes    = 0x42
+	kdbxHeaderHMACIndex = ^uint64(0)
+)
+
+// WriteKDBX writes entries as a KeePass database named name, protected by
+// password.
+func WriteKDBX(w io.Writer, password string, name string, entries []VaultEntry) error {
+	return writeKDBX(w, password, name, entries, kdbxRounds)
+}
+
+// writeKDBX writes a KeePass database like WriteKDBX, with rounds of
+// AES-KDF.
+func writeKDBX(w io.Writer, password string, name string, entries []VaultEntry, rounds uint64) error {
+	random := make([]byte, 32+16+32+64)
+	_, err := rand.Read(random)
+	if err != nil {
+		return err
+	}
+	masterSeed, iv, kdfSeed, innerKey := random[:32], random[32:48], random[48:80], random[80:]
+
+	var kdf bytes.Buffer
+	binary.Write(&kdf, binary.LittleEndian, uint16(kdbxVariantVersion))
+	writeVariant(&kdf, kdbxVariantBytes, "$UUID", kdbxAESKDF)
+	writeVariant(&kdf, kdbxVariantUInt64, "R", binary.LittleEndian.AppendUint64(nil, rounds))
+	writeVariant(&kdf, kdbxVariantBytes, "S", kdfSeed)
+	kdf.WriteByte(0)
+
+	var header bytes.Buffer
+	header.Write(kdbxSignature)
+	header.Write(kdbxVersion)
+	writeHeaderField(&header, kdbxCipherID, kdbxAES256)
+	writeHeaderField(&header, kdbxCompression, binary.LittleEndian.AppendUint32(nil, kdbxGzip))
+	writeHeaderField(&header, kdbxMasterSeed, masterSeed)
+	writeHeaderField(&header, kdbxEncryptionIV, iv)
+	writeHeaderField(&header, kdbxKdfParameters, kdf.Bytes())
+	writeHeaderField(&header, kdbxEndOfHeader, []byte("\r\n\r\n"))
+
+	key, hmacKey, err := kdbxKeys(password, kdfSeed, rounds, masterSeed)
+	if err != nil {
+		return err
+	}
+	headerHash := sha256.Sum256(header.Bytes())
+	headerHMAC := hmac.New(sha256.New, kdbxBlockKey(hmacKey, kdbxHeaderHMACIndex))
+	headerHMAC.Write(header.Bytes())
+
+	var inner bytes.Buffer
+	writeHeaderField(&inner, kdbxInnerStreamID, binary.LittleEndian.AppendUint32(nil, kdbxInnerChaCha20))
+	writeHeaderField(&inner, kdbxInnerStreamKey, innerKey)
+	writeHeaderField(&inner, kdbxEndOfHeader, nil)
+	streamKey := sha512.Sum512(innerKey)
+	stream, err := chacha20.NewUnauthenticatedCipher(streamKey[:32], streamKey[32:44])
+	if err != nil {
+		return err
+	}
+	document, err := kdbxXML(name, entries, stream)
+	if err != nil {
+		return err
+	}
+	inner.Write(document)
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(inner.Bytes())
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	padding := aes.BlockSize - compressed.Len()%aes.BlockSize
+	plaintext := append(compressed.Bytes(), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	encrypted := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plaintext)
+
+	var file bytes.Buffer
+	file.Write(header.Bytes())
+	file.Write(headerHash[:])
+	file.Write(headerHMAC.Sum(nil))
+	for index := uint64(0); ; index++ {
+		data := encrypted
+		if len(data) > kdbxBlockSize {
+			data = data[:kdbxBlockSize]
+		}
+		encrypted = encrypted[len(data):]
+		size := binary.LittleEndian.AppendUint32(nil, uint32(len(data)))
+		blockHMAC := hmac.New(sha256.New, kdbxBlockKey(hmacKey, index))
+		blockHMAC.Write(binary.LittleEndian.AppendUint64(nil, index))
+		blockHMAC.Write(size)
+		blockHMAC.Write(data)
+		file.Write(blockHMAC.Sum(nil))
+		file.Write(size)
+		file.Write(data)
+		if len(data) == 0 {
+			break
+		}
+	}
+	_, err = w.Write(file.Bytes())
+	return err
+}
+
+// kdbxKeys derives the cipher key and the HMAC base key of a database.
+func kdbxKeys(password string, kdfSeed []byte, rounds uint64, masterSeed []byte) ([]byte, []byte, error) {
+	passwordHash := sha256.Sum256([]byte(password))
+	compositeKey := sha256.Sum256(passwordHash[:])
+	block, err := aes.NewCipher(kdfSeed)
+	if err != nil {
+		return nil, nil, err
+	}
+	transformed := compositeKey
+	for i := uint64(0); i < rounds; i++ {
+		block.Encrypt(transformed[:16], transformed[:16])
+		block.Encrypt(transformed[16:], transformed[16:])
+	}
+	transformedKey := sha256.Sum256(transformed[:])
+	seeded := append(append([]byte(nil), masterSeed...), transformedKey[:]...)
+	key := sha256.Sum256(seeded)
+	hmacKey := sha512.Sum512(append(seeded, 1))
+	return key[:], hmacKey[:], nil
+}
+
+// kdbxBlockKey is the HMAC key of the block at index.
+func kdbxBlockKey(hmacKey []byte, index uint64) []byte {
+	key := sha512.Sum512(append(binary.LittleEndian.AppendUint64(nil, index), hmacKey...))
+	return key[:]
+}
+
+func writeHeaderField(w *bytes.Buffer, id byte, data []byte) {
+	w.WriteByte(id)
+	binary.Write(w, binary.LittleEndian, uint32(len(data)))
+	w.Write(data)
+}
+
+func writeVariant(w *bytes.Buffer, valueType byte, name string, value []byte) {
+	w.WriteByte(valueType)
+	binary.Write(w, binary.LittleEndian, uint32(len(name)))
+	w.WriteString(name)
+	binary.Write(w, binary.LittleEndian, uint32(len(value)))
+	w.Write(value)
+}
+
+type kdbxFile struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    kdbxMeta
+	Root    kdbxGroup `xml:"Root>Group"`
+}
+
+type kdbxMeta struct {
+	Generator    string
+	DatabaseName string
+}
+
+type kdbxGroup struct {
+	UUID    string
+	Name    string
+	Entries []kdbxEntry `xml:"Entry"`
+	Groups  []kdbxGroup `xml:"Group"`
+}
+
+type kdbxEntry struct {
+	UUID    string
+	Tags    string       `xml:",omitempty"`
+	Strings []kdbxString `xml:"String"`
+}
+
+type kdbxString struct {
+	Key   string
+	Value kdbxValue
+}
+
+type kdbxValue struct {
+	Protected string `xml:",attr,omitempty"`
+	Text      string `xml:",chardata"`
+}
+
+// kdbxXML is the XML document of the entries, with the passwords XORed with
+// stream in document order.
+func kdbxXML(name string, entries []VaultEntry, stream *chacha20.Cipher) ([]byte, error) {
+	sorted := append([]VaultEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Title < sorted[j].Title })
+	var untagged []VaultEntry
+	groups := map[string][]VaultEntry{}
+	for _, entry := range sorted {
+		if len(entry.Tags) == 0 {
+			untagged = append(untagged, entry)
+		} else {
+			groups[entry.Tags[0]] = append(groups[entry.Tags[0]], entry)
+		}
+	}
+	var groupNames []string
+	for groupName := range groups {
+		groupNames = append(groupNames, groupName)
+	}
+	sort.Strings(groupNames)
+
+	// Passwords are protected in the order they are marshaled in, those
+	// of the root group before those of the tag groups.
+	root := kdbxGroup{Name: name}
+	var err error
+	root.UUID, root.Entries, err = kdbxEntries(untagged, stream)
+	if err != nil {
+		return nil, err
+	}
+	for _, groupName := range groupNames {
+		group := kdbxGroup{Name: groupName}
+		group.UUID, group.Entries, err = kdbxEntries(groups[groupName], stream)
+		if err != nil {
+			return nil, err
+		}
+		root.Groups = append(root.Groups, group)
+	}
+	document, err := xml.MarshalIndent(kdbxFile{Meta: kdbxMeta{Generator: "mpw-go", DatabaseName: name}, Root: root}, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), document...), nil
+}
+
+// kdbxEntries converts the entries of a group, and returns a new UUID for
+// the group.
+func kdbxEntries(entries []VaultEntry, stream *chacha20.Cipher) (string, []kdbxEntry, error) {
+	groupUUID, err := kdbxUUID()
+	if err != nil {
+		return "", nil, err
+	}
+	var converted []kdbxEntry
+	for _, entry := range entries {
+		uuid, err := kdbxUUID()
+		if err != nil {
+			return "", nil, err
+		}
+		protected := make([]byte, len(entry.Password))
+		stream.XORKeyStream(protected, []byte(entry.Password))
+		converted = append(converted, kdbxEntry{
+			UUID: uuid,
+			Tags: strings.Join(entry.Tags, ";"),
+			Strings: []kdbxString{
+				{Key: "Title", Value: kdbxValue{Text: entry.Title}},
+				{Key: "UserName", Value: kdbxValue{Text: entry.UserName}},
+				{Key: "Password", Value: kdbxValue{Protected: "True", Text: base64.StdEncoding.EncodeToString(protected)}},
+				{Key: "URL", Value: kdbxValue{Text: entry.URL}},
+				{Key: "Notes", Value: kdbxValue{Text: entry.Notes}},
+			},
+		})
+	}
+	return groupUUID, converted, nil
+}
+
+func kdbxUUID() (string, error) {
+	uuid, err := randomUUID()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(uuid), nil
+}
@@ -0,0 +1,294 @@
+package mpw
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/chacha20"
+)
+
+func TestChaCha20(t *testing.T) {
+	// RFC 7539, 2.4.2
+	key, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	nonce, _ := hex.DecodeString("000000000000004a00000000")
+	plaintext := []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+	ciphertext := make([]byte, len(plaintext))
+	stream, err := chacha20.NewUnauthenticatedCipher(key, nonce)
+	require.NoError(t, err)
+	stream.SetCounter(1)
+	stream.XORKeyStream(ciphertext[:10], plaintext[:10])
+	stream.XORKeyStream(ciphertext[10:], plaintext[10:])
+	require.Equal(t, "6e2e359a2568f98041ba0728dd0d6981e97e7aec1d4360c20a27afccfd9fae0bf91b65c5524733ab8f593dabcd62b3571639d624e65152ab8f530c359f0861d807ca0dbf500d6a6156a38e088a22b65e52bc514d16ccf806818ce91ab77937365af90bbf74a35be6b40b8eedf2785e42874d", hex.EncodeToString(ciphertext))
+}
+
+func TestKDBXKeys(t *testing.T) {
+	// Computed from the KDBX 4 specification with OpenSSL and Python:
+	//
+	//	t = sha256(sha256(password))
+	//	3 times: t = openssl enc -aes-256-ecb -nopad -K <kdfSeed> < t
+	//	transformed = sha256(t)
+	//	key = sha256(masterSeed + transformed)
+	//	hmacKey = sha512(masterSeed + transformed + b"\x01")
+	//	blockKey(i) = sha512(struct.pack("<Q", i) + hmacKey)
+	kdfSeed := make([]byte, 32)
+	masterSeed := make([]byte, 32)
+	for i := range kdfSeed {
+		kdfSeed[i] = byte(i)
+		masterSeed[i] = byte(32 + i)
+	}
+	key, hmacKey, err := kdbxKeys("export password", kdfSeed, 3, masterSeed)
+	require.NoError(t, err)
+	require.Equal(t, "2eba10d98b3c3ff389f2aa2f19dd04cab3168abec8e0dcc8a64b07ea3cfdc0db", hex.EncodeToString(key))
+	require.Equal(t, "c212042e3c5302462e3f929a423dd0fe4eb93f35cd590082715d59f7ffc9d4bf52139849945e5966b6c075d5891504dc9de66db9c35a8da8b58eac6acd900d61", hex.EncodeToString(hmacKey))
+	require.Equal(t, "864f17583c456a35b3787641b0b1256eed43d16dfd2549833ae50ad0dea5035c235761c8af680432ecbe0658ed99a7a9fc27b619e014289d89b997dde37fd8c7", hex.EncodeToString(kdbxBlockKey(hmacKey, 0)))
+	require.Equal(t, "52c25cf288a460ac673a6e0b275b5e3fef755ac44653d07fd172398d35f66b27c5d4c7d4cf52403d62fab010f4b35fa7b2416e39bf00a6828eb73e57b6558ed2", hex.EncodeToString(kdbxBlockKey(hmacKey, kdbxHeaderHMACIndex)))
+}
+
+func TestKDBX(t *testing.T) {
+	entries := []VaultEntry{
+		{Title: "masterpasswordapp.com", UserName: "robert", Password: "Jejr5[RepuSosp", URL: "https://masterpasswordapp.com", Notes: "Notes <&>"},
+		{Title: "example.com", UserName: "wohzaqage", Password: "Feji5@ReduWosh", Tags: []string{"work", "mail"}},
+		{Title: "bank.example", UserName: "rlm", Password: "1234", Tags: []string{"finance"}},
+		{Title: "intranet.example", UserName: "rlm", Password: "secret ⛄", Tags: []string{"work"}},
+	}
+	var file bytes.Buffer
+	require.NoError(t, writeKDBX(&file, "export password", "mpw", entries, 10))
+
+	name, read, err := readKDBX(file.Bytes(), "export password")
+	require.NoError(t, err)
+	require.Equal(t, "mpw", name)
+	require.Equal(t, map[string][]VaultEntry{
+		"":        {entries[0]},
+		"finance": {entries[2]},
+		"work":    {entries[1], entries[3]},
+	}, read)
+
+	_, _, err = readKDBX(file.Bytes(), "wrong password")
+	require.Error(t, err)
+	tampered := append([]byte(nil), file.Bytes()...)
+	tampered[len(tampered)-100] ^= 1
+	_, _, err = readKDBX(tampered, "export password")
+	require.Error(t, err)
+}
+
+// readKDBX reads a KDBX 4 database written by WriteKDBX, and returns its
+// name and its entries by group, the root group named "".
+func readKDBX(file []byte, password string) (string, map[string][]VaultEntry, error) {
+	r := bytes.NewReader(file)
+	signature := make([]byte, 12)
+	io.ReadFull(r, signature)
+	if !bytes.Equal(signature, append(append([]byte(nil), kdbxSignature...), kdbxVersion...)) {
+		return "", nil, errors.New("not a KDBX 4 file")
+	}
+	fields := map[byte][]byte{}
+	for {
+		id, data, err := readHeaderField(r)
+		if err != nil {
+			return "", nil, err
+		}
+		if id == kdbxEndOfHeader {
+			break
+		}
+		fields[id] = data
+	}
+	header := file[:len(file)-r.Len()]
+	hash := make([]byte, 32)
+	headerHMAC := make([]byte, 32)
+	io.ReadFull(r, hash)
+	io.ReadFull(r, headerHMAC)
+	if expected := sha256.Sum256(header); !bytes.Equal(hash, expected[:]) {
+		return "", nil, errors.New("header damaged")
+	}
+	if !bytes.Equal(fields[kdbxCipherID], kdbxAES256) {
+		return "", nil, errors.New("cipher not AES-256")
+	}
+	kdf, err := readVariants(fields[kdbxKdfParameters])
+	if err != nil {
+		return "", nil, err
+	}
+	if !bytes.Equal(kdf["$UUID"], kdbxAESKDF) {
+		return "", nil, errors.New("KDF not AES-KDF")
+	}
+	key, hmacKey, err := kdbxKeys(password, kdf["S"], binary.LittleEndian.Uint64(kdf["R"]), fields[kdbxMasterSeed])
+	if err != nil {
+		return "", nil, err
+	}
+	mac := hmac.New(sha256.New, kdbxBlockKey(hmacKey, kdbxHeaderHMACIndex))
+	mac.Write(header)
+	if !hmac.Equal(headerHMAC, mac.Sum(nil)) {
+		return "", nil, errors.New("wrong password or header damaged")
+	}
+
+	var encrypted []byte
+	for index := uint64(0); ; index++ {
+		blockHMAC := make([]byte, 32)
+		size := make([]byte, 4)
+		io.ReadFull(r, blockHMAC)
+		_, err := io.ReadFull(r, size)
+		if err != nil {
+			return "", nil, err
+		}
+		data := make([]byte, binary.LittleEndian.Uint32(size))
+		_, err = io.ReadFull(r, data)
+		if err != nil {
+			return "", nil, err
+		}
+		mac := hmac.New(sha256.New, kdbxBlockKey(hmacKey, index))
+		mac.Write(binary.LittleEndian.AppendUint64(nil, index))
+		mac.Write(size)
+		mac.Write(data)
+		if !hmac.Equal(blockHMAC, mac.Sum(nil)) {
+			return "", nil, errors.New("block damaged")
+		}
+		if len(data) == 0 {
+			break
+		}
+		encrypted = append(encrypted, data...)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", nil, err
+	}
+	plaintext := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, fields[kdbxEncryptionIV]).CryptBlocks(plaintext, encrypted)
+	plaintext = plaintext[:len(plaintext)-int(plaintext[len(plaintext)-1])]
+	gz, err := gzip.NewReader(bytes.NewReader(plaintext))
+	if err != nil {
+		return "", nil, err
+	}
+	inner, err := io.ReadAll(gz)
+	if err != nil {
+		return "", nil, err
+	}
+
+	r = bytes.NewReader(inner)
+	innerFields := map[byte][]byte{}
+	for {
+		id, data, err := readHeaderField(r)
+		if err != nil {
+			return "", nil, err
+		}
+		if id == kdbxEndOfHeader {
+			break
+		}
+		innerFields[id] = data
+	}
+	if binary.LittleEndian.Uint32(innerFields[kdbxInnerStreamID]) != kdbxInnerChaCha20 {
+		return "", nil, errors.New("inner stream not ChaCha20")
+	}
+	streamKey := sha512.Sum512(innerFields[kdbxInnerStreamKey])
+	stream, err := chacha20.NewUnauthenticatedCipher(streamKey[:32], streamKey[32:44])
+	if err != nil {
+		return "", nil, err
+	}
+	var document kdbxFile
+	err = xml.NewDecoder(r).Decode(&document)
+	if err != nil {
+		return "", nil, err
+	}
+
+	groups := map[string][]VaultEntry{}
+	readEntries := func(group string, entries []kdbxEntry) error {
+		for _, entry := range entries {
+			var read VaultEntry
+			if entry.Tags != "" {
+				read.Tags = strings.Split(entry.Tags, ";")
+			}
+			for _, s := range entry.Strings {
+				value := s.Value.Text
+				if s.Value.Protected == "True" {
+					protected, err := base64.StdEncoding.DecodeString(value)
+					if err != nil {
+						return err
+					}
+					stream.XORKeyStream(protected, protected)
+					value = string(protected)
+				}
+				switch s.Key {
+				case "Title":
+					read.Title = value
+				case "UserName":
+					read.UserName = value
+				case "Password":
+					read.Password = value
+				case "URL":
+					read.URL = value
+				case "Notes":
+					read.Notes = value
+				}
+			}
+			groups[group] = append(groups[group], read)
+		}
+		return nil
+	}
+	err = readEntries("", document.Root.Entries)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, group := range document.Root.Groups {
+		err = readEntries(group.Name, group.Entries)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return document.Meta.DatabaseName, groups, nil
+}
+
+func readHeaderField(r *bytes.Reader) (byte, []byte, error) {
+	id, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var size uint32
+	err = binary.Read(r, binary.LittleEndian, &size)
+	if err != nil {
+		return 0, nil, err
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	return id, data, err
+}
+
+func readVariants(b []byte) (map[string][]byte, error) {
+	r := bytes.NewReader(b)
+	var version uint16
+	binary.Read(r, binary.LittleEndian, &version)
+	if version>>8 != kdbxVariantVersion>>8 {
+		return nil, errors.New("variant dictionary version not supported")
+	}
+	variants := map[string][]byte{}
+	for {
+		valueType, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if valueType == 0 {
+			return variants, nil
+		}
+		var size uint32
+		binary.Read(r, binary.LittleEndian, &size)
+		name := make([]byte, size)
+		io.ReadFull(r, name)
+		binary.Read(r, binary.LittleEndian, &size)
+		value := make([]byte, size)
+		_, err = io.ReadFull(r, value)
+		if err != nil {
+			return nil, err
+		}
+		variants[string(name)] = value
+	}
+}
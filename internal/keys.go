@@ -0,0 +1,53 @@
+package mpw
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"fmt"
+)
+
+// Derived keys
+//
+// Besides site results, the master key can derive keys for other
+// cryptographic uses. Each use derives its site key in a scope of its own,
+// so that a derived key is unrelated to the site's password even when it
+// is published, as public keys are. These scopes are specific to mpw-go.
+//
+// ´´´
+// derivedKey = HKDF-Expand( PRK, info, size )
+// PRK = <site key in scope>
+// info = ""
+// ´´´
+//
+// Keys up to the site key length of 32 bytes are the first bytes of the
+// first HKDF block, longer keys continue in the following blocks.
+const (
+	KeyScope = "com.github.emiljoha.mpw-go.key"
+)
+
+// DerivedKey derives a size byte key for siteName in scope.
+func DerivedKey(masterKey []byte, scope string, siteName string, siteCounter int, size int) ([]byte, error) {
+	if size <= 0 || size > 255*crypto.SHA256.Size() {
+		return nil, fmt.Errorf("key size %d not between 1 and %d bytes", size, 255*crypto.SHA256.Size())
+	}
+	site, err := siteKey(siteName, masterKey, uint(siteCounter), scope, "")
+	if err != nil {
+		return nil, err
+	}
+	return hkdfExpand(site, nil, size), nil
+}
+
+// hkdfExpand is the expand step of HKDF with SHA-256, RFC 5869.
+func hkdfExpand(prk []byte, info []byte, size int) []byte {
+	okm := make([]byte, 0, size)
+	var block []byte
+	for i := byte(1); len(okm) < size; i++ {
+		hash := hmac.New(crypto.SHA256.New, prk)
+		hash.Write(block)
+		hash.Write(info)
+		hash.Write([]byte{i})
+		block = hash.Sum(nil)
+		okm = append(okm, block...)
+	}
+	return okm[:size]
+}
@@ -0,0 +1,42 @@
+package mpw
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHKDFExpand(t *testing.T) {
+	// RFC 5869 test case 1.
+	prk, _ := hex.DecodeString("077709362c2e32df0ddc3f0dc47bba6390b6c73bb50f9c3122ec844ad7c2b3e5")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	okm := hkdfExpand(prk, info, 42)
+	require.Equal(t, "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865", hex.EncodeToString(okm))
+}
+
+func TestDerivedKey(t *testing.T) {
+	master, err := MasterKey("Robert Lee Mitchell", "banana colored duckling")
+	require.NoError(t, err)
+
+	key, err := DerivedKey(master, KeyScope, "masterpasswordapp.com", 1, 64)
+	require.NoError(t, err)
+	require.Len(t, key, 64)
+	short, err := DerivedKey(master, KeyScope, "masterpasswordapp.com", 1, 16)
+	require.NoError(t, err)
+	require.Equal(t, key[:16], short)
+
+	site, err := siteKey("masterpasswordapp.com", master, 1, scopes[Authentication], "")
+	require.NoError(t, err)
+	password, err := DerivedKey(master, scopes[Authentication], "masterpasswordapp.com", 1, 32)
+	require.NoError(t, err)
+	require.NotEqual(t, site, key[:32])
+	require.Equal(t, hkdfExpand(site, nil, 32), password)
+
+	counter, err := DerivedKey(master, KeyScope, "masterpasswordapp.com", 2, 64)
+	require.NoError(t, err)
+	require.NotEqual(t, key, counter)
+
+	_, err = DerivedKey(master, KeyScope, "masterpasswordapp.com", 1, 0)
+	require.Error(t, err)
+}
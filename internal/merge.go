@@ -0,0 +1,69 @@
+package mpw
+
+import (
+	"sort"
+)
+
+// Merging sites stores
+//
+// Sites stores kept in git on several machines are merged site by site
+// against the store they were both changed from. A site changed on one
+// side only takes that change, also if it was removed. A site changed on
+// both sides takes the side with the highest counter, since a counter is
+// only ever bumped after the password was changed at the site, and else
+// the side changed last. A site removed on one side and changed on the
+// other is kept.
+func MergeSites(base, ours, theirs []Site) []Site {
+	names := map[string]bool{}
+	for _, sites := range [][]Site{base, ours, theirs} {
+		for _, site := range sites {
+			names[site.Name] = true
+		}
+	}
+	var merged []Site
+	for name := range names {
+		baseSite, inBase := FindSite(base, name)
+		ourSite, inOurs := FindSite(ours, name)
+		theirSite, inTheirs := FindSite(theirs, name)
+		ourChange := inOurs != inBase || inOurs && !sameSite(ourSite, baseSite)
+		theirChange := inTheirs != inBase || inTheirs && !sameSite(theirSite, baseSite)
+		switch {
+		case !theirChange:
+			if inOurs {
+				merged = append(merged, ourSite)
+			}
+		case !ourChange:
+			if inTheirs {
+				merged = append(merged, theirSite)
+			}
+		case !inOurs && !inTheirs:
+		case !inTheirs:
+			merged = append(merged, ourSite)
+		case !inOurs || mergeWinner(theirSite, ourSite):
+			merged = append(merged, theirSite)
+		default:
+			merged = append(merged, ourSite)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name < merged[j].Name })
+	return merged
+}
+
+// mergeWinner reports whether a wins over b when both were changed.
+func mergeWinner(a, b Site) bool {
+	if counterA, counterB := storedCounter(a), storedCounter(b); counterA != counterB {
+		return counterA > counterB
+	}
+	if a.Modified == nil || b.Modified == nil {
+		return a.Modified != nil
+	}
+	return a.Modified.After(*b.Modified)
+}
+
+// storedCounter is the counter of site, the initial counter if not set.
+func storedCounter(site Site) int {
+	if site.Counter == 0 {
+		return 1
+	}
+	return site.Counter
+}
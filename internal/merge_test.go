@@ -0,0 +1,46 @@
+package mpw
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeSites(t *testing.T) {
+	earlier := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+	base := []Site{
+		{Name: "bumped.example", Counter: 2},
+		{Name: "edited.example", Login: "robert"},
+		{Name: "removed.example"},
+		{Name: "removed-and-edited.example"},
+		{Name: "removed-on-both.example"},
+		{Name: "unchanged.example", Counter: 3},
+	}
+	ours := []Site{
+		{Name: "added-by-us.example"},
+		{Name: "bumped.example", Counter: 3, Modified: &earlier},
+		{Name: "edited.example", Login: "rob", Modified: &earlier},
+		{Name: "removed-and-edited.example", Type: "PIN", Modified: &earlier},
+		{Name: "unchanged.example", Counter: 3},
+	}
+	theirs := []Site{
+		{Name: "added-by-them.example"},
+		{Name: "bumped.example", Counter: 2, Login: "robert", Modified: &later},
+		{Name: "edited.example", Login: "bob", Modified: &later},
+		{Name: "removed.example"},
+		{Name: "unchanged.example", Counter: 3},
+	}
+	require.Equal(t, []Site{
+		{Name: "added-by-them.example"},
+		{Name: "added-by-us.example"},
+		{Name: "bumped.example", Counter: 3, Modified: &earlier},
+		{Name: "edited.example", Login: "bob", Modified: &later},
+		{Name: "removed-and-edited.example", Type: "PIN", Modified: &earlier},
+		{Name: "unchanged.example", Counter: 3},
+	}, MergeSites(base, ours, theirs))
+
+	// Merging is symmetric but for sites changed at the same time.
+	require.Equal(t, MergeSites(base, ours, theirs), MergeSites(base, theirs, ours))
+}
@@ -0,0 +1,226 @@
+package mpw
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// Recovery sheets
+//
+// A recovery sheet is a paper record of everything but the master password
+// that derives the passwords: the full name, and the parameters of every
+// site. It never holds a password. The key ID and identicon on it confirm
+// that the master password remembered is the one the sheet was printed
+// with.
+//
+// Sheets are printed on A4, as plain text pages of sheetColumns by
+// sheetLines, or as HTML.
+
+// Sheet is the content of a recovery sheet.
+type Sheet struct {
+	FullName  string
+	KeyID     string
+	Identicon string
+	Printed   time.Time
+	Sites     []SheetSite
+	Keys      []SheetKey
+}
+
+// SheetSite are the parameters of a site's password and login name.
+type SheetSite struct {
+	Name      string
+	Counter   int
+	Type      string
+	Algorithm int
+	// Login is the stored login, or how the login name is derived.
+	Login string
+}
+
+// SheetKey are the parameters of a key derived for a site, see DerivedKey.
+type SheetKey struct {
+	Name    string
+	Counter int
+	// Purpose is what the key is used for.
+	Purpose string
+	// Scope is the scope the key is derived in, such as SSHScope.
+	Scope string
+}
+
+const (
+	sheetColumns = 80
+	sheetLines   = 60
+)
+
+// WriteSheetText writes sheet as plain text, its pages separated by form
+// feeds.
+func WriteSheetText(w io.Writer, sheet Sheet) error {
+	var intro []string
+	for _, line := range sheetIntro(sheet) {
+		intro = append(intro, wrap(line, sheetColumns)...)
+	}
+	blocks := [][]string{intro}
+	for _, site := range sheet.Sites {
+		details := fmt.Sprintf("counter %d, type %s, algorithm %d, login %s", site.Counter, site.Type, site.Algorithm, site.Login)
+		blocks = append(blocks, sheetBlock(site.Name, details))
+	}
+	for i, key := range sheet.Keys {
+		details := fmt.Sprintf("%s, counter %d, scope %s", key.Purpose, key.Counter, key.Scope)
+		block := sheetBlock(key.Name, details)
+		if i == 0 {
+			// The heading stays on the page of the first key.
+			var heading []string
+			for _, line := range []string{"", "", "Derived keys", "", sheetKeysExplanation} {
+				heading = append(heading, wrap(line, sheetColumns)...)
+			}
+			block = append(heading, block...)
+		}
+		blocks = append(blocks, block)
+	}
+
+	// Every page ends with its page number after a blank line, and sites
+	// are not split across pages.
+	var pages [][]string
+	var page []string
+	for _, block := range blocks {
+		if len(page) > 0 && len(page)+len(block) > sheetLines-2 {
+			pages = append(pages, page)
+			page = nil
+		}
+		page = append(page, block...)
+	}
+	pages = append(pages, page)
+	for i, page := range pages {
+		if i > 0 {
+			io.WriteString(w, "\f")
+		}
+		for _, line := range page {
+			io.WriteString(w, line+"\n")
+		}
+		_, err := fmt.Fprintf(w, "\n%s, page %d of %d\n", sheet.FullName, i+1, len(pages))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sheetBlock is the block of lines of a site or key on a text sheet, its
+// name and the indented details.
+func sheetBlock(name string, details string) []string {
+	block := []string{"", name}
+	for _, line := range wrap(details, sheetColumns-4) {
+		block = append(block, "    "+line)
+	}
+	return block
+}
+
+// WriteSheetHTML writes sheet as an HTML document laid out for A4.
+func WriteSheetHTML(w io.Writer, sheet Sheet) error {
+	return sheetTemplate.Execute(w, struct {
+		Sheet
+		Explanation     string
+		KeysExplanation string
+	}{sheet, sheetExplanation, sheetKeysExplanation})
+}
+
+// sheetExplanation tells how the sheet is used.
+const sheetExplanation = "The passwords of the sites below are derived from the full name, the " +
+	"master password and the parameters of the site with the Master " +
+	"Password algorithm of the version given. The master password is " +
+	"right if it gives the key ID and identicon above. Login names not " +
+	"stored are derived like passwords of the Name type for the " +
+	"Identification purpose and counter 1."
+
+// sheetKeysExplanation tells how the keys on the sheet are derived.
+const sheetKeysExplanation = "The keys below, listed in SSH_KEYS and WIREGUARD_KEYS of the config, " +
+	"are derived from the master key, their name and counter in the scope given."
+
+func sheetIntro(sheet Sheet) []string {
+	return []string{
+		"Master Password recovery sheet",
+		"",
+		"Full name: " + sheet.FullName,
+		"Key ID: " + sheet.KeyID,
+		"Identicon: " + sheet.Identicon,
+		"Printed: " + sheet.Printed.Format("2006-01-02"),
+		"",
+		sheetExplanation,
+	}
+}
+
+var sheetTemplate = htmltemplate.Must(htmltemplate.New("sheet").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Master Password recovery sheet of {{.FullName}}</title>
+<style>
+@page { size: A4; margin: 15mm; }
+body { font-family: sans-serif; font-size: 10pt; }
+h1 { font-size: 14pt; }
+h2 { font-size: 12pt; }
+dt { font-weight: bold; float: left; clear: left; width: 6em; }
+dd { margin-left: 6em; }
+.key { font-family: monospace; word-break: break-all; }
+.identicon { font-size: 16pt; }
+table { width: 100%; border-collapse: collapse; }
+thead { display: table-header-group; }
+tr { page-break-inside: avoid; }
+th, td { text-align: left; padding: 1mm 2mm; border-bottom: 0.2mm solid #999; overflow-wrap: anywhere; }
+</style>
+</head>
+<body>
+<h1>Master Password recovery sheet</h1>
+<dl>
+<dt>Full name</dt><dd>{{.FullName}}</dd>
+<dt>Key ID</dt><dd class="key">{{.KeyID}}</dd>
+<dt>Identicon</dt><dd class="identicon">{{.Identicon}}</dd>
+<dt>Printed</dt><dd>{{.Printed.Format "2006-01-02"}}</dd>
+</dl>
+<p>{{.Explanation}}</p>
+<table>
+<thead>
+<tr><th>Site</th><th>Counter</th><th>Type</th><th>Algorithm</th><th>Login</th></tr>
+</thead>
+<tbody>
+{{- range .Sites}}
+<tr><td>{{.Name}}</td><td>{{.Counter}}</td><td>{{.Type}}</td><td>{{.Algorithm}}</td><td>{{.Login}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- if .Keys}}
+<h2>Derived keys</h2>
+<p>{{.KeysExplanation}}</p>
+<table>
+<thead>
+<tr><th>Name</th><th>Purpose</th><th>Counter</th><th>Scope</th></tr>
+</thead>
+<tbody>
+{{- range .Keys}}
+<tr><td>{{.Name}}</td><td>{{.Purpose}}</td><td>{{.Counter}}</td><td>{{.Scope}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// wrap breaks text into lines of at most width characters at spaces,
+// keeping the other spaces as they are. Longer words are not broken.
+func wrap(text string, width int) []string {
+	words := strings.Split(text, " ")
+	var lines []string
+	line := words[0]
+	for _, word := range words[1:] {
+		if len([]rune(line))+1+len([]rune(word)) > width {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		line += " " + word
+	}
+	return append(lines, line)
+}
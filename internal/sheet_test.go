@@ -0,0 +1,61 @@
+package mpw
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSheetText(t *testing.T) {
+	sheet := Sheet{
+		FullName:  "Robert Lee Mitchell",
+		KeyID:     "98EEF4D1DF46D849574A82A03C3177056B15DFFCA29BB3899DE4628453675302",
+		Identicon: "╔░╝⌚",
+		Printed:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	for i := 0; i < 40; i++ {
+		sheet.Sites = append(sheet.Sites, SheetSite{Name: fmt.Sprintf("site%02d.example", i), Counter: 1, Type: "Long", Algorithm: 3, Login: "derived"})
+	}
+	sheet.Sites[0].Type = "Words (5 words, \"  \", title)"
+	sheet.Keys = []SheetKey{
+		{Name: "github.com", Counter: 2, Purpose: "SSH Ed25519 key", Scope: SSHScope},
+		{Name: "wg0", Counter: 1, Purpose: "WireGuard key", Scope: WireGuardScope},
+	}
+
+	var text bytes.Buffer
+	require.NoError(t, WriteSheetText(&text, sheet))
+	pages := strings.Split(text.String(), "\f")
+	require.Len(t, pages, 3)
+	for i, page := range pages {
+		lines := strings.Split(strings.TrimSuffix(page, "\n"), "\n")
+		require.LessOrEqual(t, len(lines), sheetLines)
+		for _, line := range lines {
+			require.LessOrEqual(t, len([]rune(line)), sheetColumns)
+		}
+		require.Equal(t, fmt.Sprintf("Robert Lee Mitchell, page %d of 3", i+1), lines[len(lines)-1])
+	}
+	require.Contains(t, pages[0], "Key ID: 98EEF4D1DF46D849574A82A03C3177056B15DFFCA29BB3899DE4628453675302\n")
+	require.Contains(t, pages[0], "\nsite00.example\n    counter 1, type Words (5 words, \"  \", title), algorithm 3, login derived\n")
+	require.Contains(t, pages[2], "\nsite39.example\n    counter 1, type Long, algorithm 3, login derived\n")
+	require.Contains(t, pages[2], "\nDerived keys\n")
+	require.Contains(t, pages[2], "\ngithub.com\n    SSH Ed25519 key, counter 2, scope com.github.emiljoha.mpw-go.ssh\n")
+	require.Contains(t, pages[2], "\nwg0\n    WireGuard key, counter 1, scope com.github.emiljoha.mpw-go.wireguard\n")
+}
+
+func TestSheetHTML(t *testing.T) {
+	sheet := Sheet{
+		FullName: "Robert <Bobby> Mitchell",
+		Sites:    []SheetSite{{Name: "a&b.example", Counter: 2, Type: "PIN", Algorithm: 2, Login: "rob"}},
+		Keys:     []SheetKey{{Name: "wg0", Counter: 1, Purpose: "WireGuard key", Scope: WireGuardScope}},
+	}
+	var html bytes.Buffer
+	require.NoError(t, WriteSheetHTML(&html, sheet))
+	require.Contains(t, html.String(), "@page { size: A4;")
+	require.Contains(t, html.String(), "<dd>Robert &lt;Bobby&gt; Mitchell</dd>")
+	require.Contains(t, html.String(), "<tr><td>a&amp;b.example</td><td>2</td><td>PIN</td><td>2</td><td>rob</td></tr>")
+	require.Contains(t, html.String(), "<tr><td>wg0</td><td>WireGuard key</td><td>1</td><td>com.github.emiljoha.mpw-go.wireguard</td></tr>")
+}
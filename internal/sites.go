@@ -0,0 +1,386 @@
+package mpw
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sites store
+//
+// The algorithm needs nothing but the site name to derive a password, but
+// sites that require a different counter or result type have to be given
+// those on every invocation. The sites store remembers these parameters per
+// site, together with a login name hint, so they only have to be decided
+// once. Nothing secret is ever written to the store, but as the list of
+// sites with accounts is sensitive itself, the store can be encrypted
+// under the master key in the sites scope.
+//
+// The store holds one site per line, sorted by name, so that it can be
+// kept in git: sites changed on different machines change different lines,
+// and a merge driver can merge site by site. Stores written as a single
+// JSON array by earlier versions are still read.
+type Site struct {
+	Name    string     `json:"name"`
+	Counter int        `json:"counter,omitempty"`
+	Type    ResultType `json:"type,omitempty"`
+	Login   string     `json:"login,omitempty"`
+	// URL, Notes and Tags describe the site in exports to other password
+	// managers.
+	URL   string   `json:"url,omitempty"`
+	Notes string   `json:"notes,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	// Registry is the server URL Docker stored the login of the site
+	// under, for sites that are container registries.
+	Registry string `json:"registry,omitempty"`
+	// Passphrase shapes the passphrases of sites with the Words type.
+	Passphrase *PassphraseOptions `json:"passphrase,omitempty"`
+	// Algorithm is the algorithm version of passwords that were derived
+	// with an earlier version, CurrentAlgorithm if not set.
+	Algorithm *int `json:"algorithm,omitempty"`
+	// Previous are the passwords the site used before it was rotated,
+	// oldest first.
+	Previous []PreviousPassword `json:"previous,omitempty"`
+	// Since is when the current counter was first used, if known.
+	Since *time.Time `json:"since,omitempty"`
+	// KeyCounter is the counter of the SSH and WireGuard keys derived for
+	// the site, 1 if not set. Rotating the password keeps the keys, whose
+	// public halves are trusted elsewhere.
+	KeyCounter int `json:"key_counter,omitempty"`
+	// MaxAgeDays is the rotation policy of the site, its password is due
+	// for rotation once the current counter is older.
+	MaxAgeDays int `json:"max_age_days,omitempty"`
+	// Modified is when the site was last changed, see TouchSites.
+	Modified *time.Time `json:"modified,omitempty"`
+}
+
+// PreviousPassword records the parameters of a password that was replaced,
+// so that it can be derived again while a site is changed over.
+type PreviousPassword struct {
+	Counter   int        `json:"counter"`
+	Type      ResultType `json:"type,omitempty"`
+	Algorithm *int       `json:"algorithm,omitempty"`
+	// Since is when the password was first used, if known.
+	Since *time.Time `json:"since,omitempty"`
+	// Retired is when the password was replaced.
+	Retired time.Time `json:"retired"`
+}
+
+// RotateSite replaces the password of site with the one of counter and
+// records the replaced one in its previous passwords. The new password is
+// taken to be used from now on, and like every new password uses
+// CurrentAlgorithm.
+func RotateSite(site Site, counter int, now time.Time) Site {
+	now = now.UTC().Truncate(time.Second)
+	previous := PreviousPassword{Counter: site.Counter, Type: site.Type, Algorithm: site.Algorithm, Since: site.Since, Retired: now}
+	if previous.Counter == 0 {
+		previous.Counter = 1
+	}
+	site.Previous = append(append([]PreviousPassword(nil), site.Previous...), previous)
+	site.Counter = counter
+	site.Algorithm = nil
+	site.Since = &now
+	return site
+}
+
+// UseSite records that the current password of site is used now, unless
+// it is known since when it is used. It reports whether site changed.
+func UseSite(site Site, now time.Time) (Site, bool) {
+	if site.Since != nil {
+		return site, false
+	}
+	now = now.UTC().Truncate(time.Second)
+	site.Since = &now
+	return site, true
+}
+
+// RotationDue reports whether site has a rotation policy that its current
+// password is older than. Passwords of unknown age are due.
+func RotationDue(site Site, now time.Time) bool {
+	if site.MaxAgeDays <= 0 {
+		return false
+	}
+	if site.Since == nil {
+		return true
+	}
+	return now.Sub(*site.Since) >= time.Duration(site.MaxAgeDays)*24*time.Hour
+}
+
+// ErrSitesEncrypted is returned for an encrypted sites store read without
+// the master key.
+var ErrSitesEncrypted = errors.New("sites store is encrypted")
+
+// ReadSites reads the sites store at path. A store that does not exist yet
+// is treated as empty.
+func ReadSites(path string) ([]Site, error) {
+	return ReadEncryptedSites(path, nil)
+}
+
+// ReadEncryptedSites reads the sites store at path, decrypting it with
+// masterKey if it is encrypted.
+func ReadEncryptedSites(path string, masterKey []byte) ([]Site, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if Encrypted(b) {
+		if masterKey == nil {
+			return nil, ErrSitesEncrypted
+		}
+		b, err = Decrypt(masterKey, SitesScope, b)
+		if err != nil {
+			return nil, fmt.Errorf("sites store: %w", err)
+		}
+	}
+	return unmarshalSites(b)
+}
+
+// WriteSites writes the sites sorted by name to the sites store at path.
+func WriteSites(path string, sites []Site) error {
+	b, err := marshalSites(sites)
+	if err != nil {
+		return err
+	}
+	return writeSitesFile(path, b)
+}
+
+// WriteEncryptedSites writes the sites like WriteSites, encrypted under
+// masterKey.
+func WriteEncryptedSites(path string, masterKey []byte, sites []Site) error {
+	b, err := marshalSites(sites)
+	if err != nil {
+		return err
+	}
+	b, err = Encrypt(masterKey, SitesScope, b)
+	if err != nil {
+		return err
+	}
+	return writeSitesFile(path, b)
+}
+
+func marshalSites(sites []Site) ([]byte, error) {
+	sorted := make([]Site, len(sites))
+	copy(sorted, sites)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	var b []byte
+	for _, site := range sorted {
+		line, err := json.Marshal(site)
+		if err != nil {
+			return nil, err
+		}
+		b = append(append(b, line...), '\n')
+	}
+	return b, nil
+}
+
+func unmarshalSites(b []byte) ([]Site, error) {
+	var sites []Site
+	if trimmed := bytes.TrimSpace(b); bytes.HasPrefix(trimmed, []byte("[")) {
+		err := json.Unmarshal(trimmed, &sites)
+		if err != nil {
+			return nil, err
+		}
+		return sites, nil
+	}
+	for i, line := range bytes.Split(b, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var site Site
+		err := json.Unmarshal(line, &site)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		sites = append(sites, site)
+	}
+	return sites, nil
+}
+
+func writeSitesFile(path string, b []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, b, true)
+}
+
+// WriteFileAtomic writes data readable only by the user to path through a
+// temporary file, so that path never holds a partial file or wider
+// permissions. An existing file is only replaced if overwrite is set.
+func WriteFileAtomic(path string, data []byte, overwrite bool) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if overwrite {
+		return os.Rename(f.Name(), path)
+	}
+	// A hard link fails if path exists, unlike a rename.
+	return os.Link(f.Name(), path)
+}
+
+// TouchSites sets the modification time of the sites that differ from
+// those in previous, the sites before they were changed, to now.
+func TouchSites(previous []Site, sites []Site, now time.Time) []Site {
+	now = now.UTC().Truncate(time.Second)
+	touched := make([]Site, len(sites))
+	for i, site := range sites {
+		before, found := FindSite(previous, site.Name)
+		site.Modified = before.Modified
+		if !found || !sameSite(site, before) {
+			site.Modified = &now
+		}
+		touched[i] = site
+	}
+	return touched
+}
+
+// sameSite reports whether a and b are stored the same but for their
+// modification time.
+func sameSite(a, b Site) bool {
+	a.Modified, b.Modified = nil, nil
+	encodedA, _ := json.Marshal(a)
+	encodedB, _ := json.Marshal(b)
+	return bytes.Equal(encodedA, encodedB)
+}
+
+// FindSite returns the site stored under name.
+func FindSite(sites []Site, name string) (Site, bool) {
+	for _, site := range sites {
+		if site.Name == name {
+			return site, true
+		}
+	}
+	return Site{}, false
+}
+
+// PutSite replaces the site stored under the same name or adds it.
+func PutSite(sites []Site, site Site) []Site {
+	for i := range sites {
+		if sites[i].Name == site.Name {
+			sites[i] = site
+			return sites
+		}
+	}
+	return append(sites, site)
+}
+
+// CanonicalSiteName turns a URL or host name into the site name used for
+// it, the lower case host name without port and leading "www.", so that
+// every page of a site derives the same password.
+func CanonicalSiteName(rawURL string) (string, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	host = strings.TrimPrefix(host, "www.")
+	if host == "" {
+		return "", fmt.Errorf("no host name in %s", rawURL)
+	}
+	return host, nil
+}
+
+// MaxHistory is the number of site names kept in the history.
+const MaxHistory = 100
+
+// ReadHistory reads the site names used most recently, newest first. A
+// history that does not exist yet is treated as empty.
+func ReadHistory(path string) ([]string, error) {
+	return ReadEncryptedHistory(path, nil)
+}
+
+// ReadEncryptedHistory reads the history at path like ReadHistory,
+// decrypting it with masterKey if it is encrypted. The history of an
+// encrypted sites store is encrypted like it, so that neither reveals
+// which sites exist.
+func ReadEncryptedHistory(path string, masterKey []byte) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if Encrypted(b) {
+		if masterKey == nil {
+			return nil, ErrSitesEncrypted
+		}
+		b, err = Decrypt(masterKey, SitesScope, b)
+		if err != nil {
+			return nil, fmt.Errorf("history: %w", err)
+		}
+	}
+	var history []string
+	for _, name := range strings.Split(string(b), "\n") {
+		if name != "" {
+			history = append(history, name)
+		}
+	}
+	return history, nil
+}
+
+// AddHistory moves siteName to the front of the history at path.
+func AddHistory(path string, siteName string) error {
+	return AddEncryptedHistory(path, nil, siteName)
+}
+
+// AddEncryptedHistory moves siteName to the front of the history at path
+// like AddHistory. The history is encrypted under masterKey unless it is
+// nil.
+func AddEncryptedHistory(path string, masterKey []byte, siteName string) error {
+	history, err := ReadEncryptedHistory(path, masterKey)
+	if err != nil {
+		return err
+	}
+	updated := []string{siteName}
+	for _, name := range history {
+		if name != siteName && len(updated) < MaxHistory {
+			updated = append(updated, name)
+		}
+	}
+	return WriteEncryptedHistory(path, masterKey, updated)
+}
+
+// WriteEncryptedHistory replaces the history at path, encrypted under
+// masterKey unless it is nil.
+func WriteEncryptedHistory(path string, masterKey []byte, history []string) error {
+	b := []byte(strings.Join(history, "\n") + "\n")
+	if masterKey != nil {
+		var err error
+		b, err = Encrypt(masterKey, SitesScope, b)
+		if err != nil {
+			return err
+		}
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, b, true)
+}
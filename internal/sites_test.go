@@ -0,0 +1,220 @@
+package mpw
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mpw", "sites.json")
+	sites, err := ReadSites(path)
+	require.NoError(t, err)
+	require.Empty(t, sites)
+
+	sites = PutSite(sites, Site{Name: "masterpasswordapp.com", Counter: 2})
+	sites = PutSite(sites, Site{Name: "example.com", Type: "Maximum", Login: "robert"})
+	sites = PutSite(sites, Site{Name: "masterpasswordapp.com", Counter: 3})
+	require.Len(t, sites, 2)
+	require.NoError(t, WriteSites(path, sites))
+
+	read, err := ReadSites(path)
+	require.NoError(t, err)
+	require.Equal(t, []Site{
+		{Name: "example.com", Type: "Maximum", Login: "robert"},
+		{Name: "masterpasswordapp.com", Counter: 3},
+	}, read)
+	site, found := FindSite(read, "masterpasswordapp.com")
+	require.True(t, found)
+	require.Equal(t, 3, site.Counter)
+	_, found = FindSite(read, "unknown.com")
+	require.False(t, found)
+}
+
+func TestEncryptedSites(t *testing.T) {
+	masterKey := bytes.Repeat([]byte{1}, 64)
+	path := filepath.Join(t.TempDir(), "mpw", "sites.json")
+	sites := []Site{{Name: "masterpasswordapp.com", Counter: 2, Login: "robert"}}
+	require.NoError(t, WriteEncryptedSites(path, masterKey, sites))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	file, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.True(t, Encrypted(file))
+	require.NotContains(t, string(file), "masterpasswordapp.com")
+	keyID, err := hex.DecodeString(KeyID(masterKey))
+	require.NoError(t, err)
+	require.Contains(t, string(file), string(keyID))
+
+	read, err := ReadEncryptedSites(path, masterKey)
+	require.NoError(t, err)
+	require.Equal(t, sites, read)
+	_, err = ReadSites(path)
+	require.True(t, errors.Is(err, ErrSitesEncrypted))
+	_, err = ReadEncryptedSites(path, bytes.Repeat([]byte{2}, 64))
+	require.True(t, errors.Is(err, ErrWrongMasterKey))
+
+	for _, i := range []int{len(file) / 2, len(file) - 1} {
+		tampered := append([]byte(nil), file...)
+		tampered[i] ^= 1
+		require.NoError(t, os.WriteFile(path, tampered, 0600))
+		_, err = ReadEncryptedSites(path, masterKey)
+		require.Error(t, err)
+	}
+
+	// Unencrypted stores are read with or without the master key.
+	require.NoError(t, WriteSites(path, sites))
+	read, err = ReadEncryptedSites(path, masterKey)
+	require.NoError(t, err)
+	require.Equal(t, sites, read)
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	history, err := ReadHistory(path)
+	require.NoError(t, err)
+	require.Empty(t, history)
+
+	for _, name := range []string{"a.com", "b.com", "c.com", "a.com"} {
+		require.NoError(t, AddHistory(path, name))
+	}
+	history, err = ReadHistory(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.com", "c.com", "b.com"}, history)
+
+	for i := 0; i < MaxHistory+10; i++ {
+		require.NoError(t, AddHistory(path, fmt.Sprintf("%d.com", i)))
+	}
+	history, err = ReadHistory(path)
+	require.NoError(t, err)
+	require.Len(t, history, MaxHistory)
+	require.Equal(t, fmt.Sprintf("%d.com", MaxHistory+9), history[0])
+}
+
+func TestEncryptedHistory(t *testing.T) {
+	masterKey := bytes.Repeat([]byte{1}, 64)
+	path := filepath.Join(t.TempDir(), "history")
+	for _, name := range []string{"a.com", "b.com", "a.com"} {
+		require.NoError(t, AddEncryptedHistory(path, masterKey, name))
+	}
+	file, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.True(t, Encrypted(file))
+	require.NotContains(t, string(file), "a.com")
+
+	history, err := ReadEncryptedHistory(path, masterKey)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.com", "b.com"}, history)
+	_, err = ReadHistory(path)
+	require.True(t, errors.Is(err, ErrSitesEncrypted))
+	_, err = ReadEncryptedHistory(path, bytes.Repeat([]byte{2}, 64))
+	require.True(t, errors.Is(err, ErrWrongMasterKey))
+}
+
+func TestCanonicalSiteName(t *testing.T) {
+	for rawURL, siteName := range map[string]string{
+		"https://www.GitHub.com/emiljoha/mpw-go": "github.com",
+		"http://login.example.com:8080/?next=/":  "login.example.com",
+		"example.com.":                           "example.com",
+		"ftp://user@files.example.org/pub":       "files.example.org",
+		"masterpasswordapp.com":                  "masterpasswordapp.com",
+	} {
+		canonical, err := CanonicalSiteName(rawURL)
+		require.NoError(t, err)
+		require.Equal(t, siteName, canonical, rawURL)
+	}
+	_, err := CanonicalSiteName("file:///etc/passwd")
+	require.Error(t, err)
+}
+
+func TestRotateSite(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(time.Hour)
+	site := Site{Name: "example.com", Type: "Maximum"}
+	algorithm := 1
+	site.Algorithm = &algorithm
+	site = RotateSite(site, 2, now)
+	require.Nil(t, site.Algorithm)
+	site = RotateSite(site, 3, later)
+	require.Equal(t, 3, site.Counter)
+	require.Equal(t, &later, site.Since)
+	require.Equal(t, []PreviousPassword{
+		{Counter: 1, Type: "Maximum", Algorithm: &algorithm, Retired: now},
+		{Counter: 2, Type: "Maximum", Since: &now, Retired: later},
+	}, site.Previous)
+
+	path := filepath.Join(t.TempDir(), "sites.json")
+	require.NoError(t, WriteSites(path, []Site{site}))
+	read, err := ReadSites(path)
+	require.NoError(t, err)
+	require.Equal(t, []Site{site}, read)
+}
+
+func TestRotationDue(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	site := Site{Name: "example.com"}
+	require.False(t, RotationDue(site, now))
+	site.MaxAgeDays = 90
+	require.True(t, RotationDue(site, now))
+
+	site, changed := UseSite(site, now)
+	require.True(t, changed)
+	_, changed = UseSite(site, now.Add(time.Hour))
+	require.False(t, changed)
+	require.False(t, RotationDue(site, now.AddDate(0, 0, 89)))
+	require.True(t, RotationDue(site, now.AddDate(0, 0, 90)))
+
+	site = RotateSite(site, 2, now.AddDate(0, 0, 100))
+	require.False(t, RotationDue(site, now.AddDate(0, 0, 100)))
+}
+
+func TestSitesFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sites.json")
+	sites := []Site{{Name: "masterpasswordapp.com", Counter: 2}, {Name: "example.com", Login: "robert"}}
+	require.NoError(t, WriteSites(path, sites))
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `{"name":"example.com","login":"robert"}
+{"name":"masterpasswordapp.com","counter":2}
+`, string(b))
+
+	// Stores of earlier versions are a JSON array.
+	require.NoError(t, os.WriteFile(path, []byte(`[
+	{
+		"name": "masterpasswordapp.com",
+		"counter": 2
+	}
+]
+`), 0600))
+	read, err := ReadSites(path)
+	require.NoError(t, err)
+	require.Equal(t, []Site{{Name: "masterpasswordapp.com", Counter: 2}}, read)
+}
+
+func TestTouchSites(t *testing.T) {
+	earlier := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := earlier.Add(time.Hour)
+	previous := []Site{
+		{Name: "changed.example", Modified: &earlier},
+		{Name: "unchanged.example", Counter: 2, Modified: &earlier},
+	}
+	touched := TouchSites(previous, []Site{
+		{Name: "added.example"},
+		{Name: "changed.example", Counter: 2, Modified: &earlier},
+		{Name: "unchanged.example", Counter: 2, Modified: &earlier},
+	}, now.Add(time.Millisecond))
+	require.Equal(t, []Site{
+		{Name: "added.example", Modified: &now},
+		{Name: "changed.example", Counter: 2, Modified: &now},
+		{Name: "unchanged.example", Counter: 2, Modified: &earlier},
+	}, touched)
+}
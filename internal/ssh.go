@@ -0,0 +1,151 @@
+package mpw
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SSH keys
+//
+// An Ed25519 key pair is fully determined by its 32 byte seed, which is
+// derived from the site key in the SSH scope. Only the public key needs to
+// leave the machine, the private key can be regenerated from the master
+// password at any time.
+const SSHScope = "com.github.emiljoha.mpw-go.ssh"
+
+// SSHKey derives the Ed25519 key pair of siteName.
+func SSHKey(masterKey []byte, siteName string, siteCounter int) (ed25519.PrivateKey, error) {
+	seed, err := DerivedKey(masterKey, SSHScope, siteName, siteCounter, ed25519.SeedSize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// SSHPublicKey formats key as an OpenSSH authorized_keys line.
+func SSHPublicKey(key ed25519.PublicKey, comment string) string {
+	line := "ssh-ed25519 " + base64.StdEncoding.EncodeToString(sshKeyBlob(key))
+	if comment != "" {
+		line += " " + comment
+	}
+	return line
+}
+
+func sshKeyBlob(key ed25519.PublicKey) []byte {
+	var blob bytes.Buffer
+	writeSSHString(&blob, []byte("ssh-ed25519"))
+	writeSSHString(&blob, key)
+	return blob.Bytes()
+}
+
+// SSH agent protocol
+//
+// The agent answers identity listings and signature requests for its keys
+// and refuses everything else, keys can neither be added nor removed.
+const (
+	sshAgentFailure           = 5
+	sshAgentRequestIdentities = 11
+	sshAgentIdentitiesAnswer  = 12
+	sshAgentSignRequest       = 13
+	sshAgentSignResponse      = 14
+	maxSSHAgentMessage        = 256 * 1024
+)
+
+// SSHAgentKey is a key served by the agent together with its comment.
+type SSHAgentKey struct {
+	Key     ed25519.PrivateKey
+	Comment string
+}
+
+// ServeSSHAgent answers the agent requests on conn until it is closed.
+func ServeSSHAgent(conn io.ReadWriter, keys []SSHAgentKey) error {
+	for {
+		var length uint32
+		err := binary.Read(conn, binary.BigEndian, &length)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if length == 0 || length > maxSSHAgentMessage {
+			return fmt.Errorf("agent message length %d invalid", length)
+		}
+		request := make([]byte, length)
+		_, err = io.ReadFull(conn, request)
+		if err != nil {
+			return err
+		}
+		response := sshAgentResponse(request, keys)
+		err = binary.Write(conn, binary.BigEndian, uint32(len(response)))
+		if err != nil {
+			return err
+		}
+		_, err = conn.Write(response)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func sshAgentResponse(request []byte, keys []SSHAgentKey) []byte {
+	failure := []byte{sshAgentFailure}
+	switch request[0] {
+	case sshAgentRequestIdentities:
+		var response bytes.Buffer
+		response.WriteByte(sshAgentIdentitiesAnswer)
+		binary.Write(&response, binary.BigEndian, uint32(len(keys)))
+		for _, key := range keys {
+			writeSSHString(&response, sshKeyBlob(key.Key.Public().(ed25519.PublicKey)))
+			writeSSHString(&response, []byte(key.Comment))
+		}
+		return response.Bytes()
+	case sshAgentSignRequest:
+		payload := bytes.NewReader(request[1:])
+		blob, err := readSSHString(payload)
+		if err != nil {
+			return failure
+		}
+		data, err := readSSHString(payload)
+		if err != nil {
+			return failure
+		}
+		for _, key := range keys {
+			if !bytes.Equal(blob, sshKeyBlob(key.Key.Public().(ed25519.PublicKey))) {
+				continue
+			}
+			var signature bytes.Buffer
+			writeSSHString(&signature, []byte("ssh-ed25519"))
+			writeSSHString(&signature, ed25519.Sign(key.Key, data))
+			var response bytes.Buffer
+			response.WriteByte(sshAgentSignResponse)
+			writeSSHString(&response, signature.Bytes())
+			return response.Bytes()
+		}
+	}
+	return failure
+}
+
+func writeSSHString(w *bytes.Buffer, s []byte) {
+	binary.Write(w, binary.BigEndian, uint32(len(s)))
+	w.Write(s)
+}
+
+func readSSHString(r *bytes.Reader) ([]byte, error) {
+	var length uint32
+	err := binary.Read(r, binary.BigEndian, &length)
+	if err != nil {
+		return nil, err
+	}
+	if int64(length) > int64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	s := make([]byte, length)
+	_, err = io.ReadFull(r, s)
+	return s, err
+}
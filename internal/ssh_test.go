@@ -0,0 +1,105 @@
+package mpw
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSHKey(t *testing.T) {
+	master, err := MasterKey("Robert Lee Mitchell", "banana colored duckling")
+	require.NoError(t, err)
+	key, err := SSHKey(master, "github.com", 1)
+	require.NoError(t, err)
+	again, err := SSHKey(master, "github.com", 1)
+	require.NoError(t, err)
+	require.Equal(t, key, again)
+	other, err := SSHKey(master, "github.com", 2)
+	require.NoError(t, err)
+	require.NotEqual(t, key, other)
+
+	require.Equal(t, "WS1JY1G/psqUgzbNxVD2qC/V2QScXXN8cVV5KsdqWn0=", base64.StdEncoding.EncodeToString(key.Seed()))
+	line := SSHPublicKey(key.Public().(ed25519.PublicKey), "github.com")
+	// The public key as openssl pkey -pubout derives it from the seed.
+	require.Equal(t, "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIL8SULSh0JZucUtPcVoxaHj3iDbpreeymvD01ArN7GC1 github.com", line)
+	fields := strings.Fields(line)
+	require.Len(t, fields, 3)
+	require.Equal(t, "ssh-ed25519", fields[0])
+	require.Equal(t, "github.com", fields[2])
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	require.NoError(t, err)
+	require.Len(t, blob, 4+len("ssh-ed25519")+4+ed25519.PublicKeySize)
+	require.True(t, bytes.HasSuffix(blob, key.Public().(ed25519.PublicKey)))
+}
+
+func TestSSHAgent(t *testing.T) {
+	master, err := MasterKey("Robert Lee Mitchell", "banana colored duckling")
+	require.NoError(t, err)
+	key, err := SSHKey(master, "github.com", 1)
+	require.NoError(t, err)
+	client, server := net.Pipe()
+	defer client.Close()
+	go ServeSSHAgent(server, []SSHAgentKey{{Key: key, Comment: "github.com"}})
+
+	roundTrip := func(request []byte) *bytes.Reader {
+		require.NoError(t, binary.Write(client, binary.BigEndian, uint32(len(request))))
+		_, err := client.Write(request)
+		require.NoError(t, err)
+		var length uint32
+		require.NoError(t, binary.Read(client, binary.BigEndian, &length))
+		response := make([]byte, length)
+		_, err = io.ReadFull(client, response)
+		require.NoError(t, err)
+		return bytes.NewReader(response)
+	}
+
+	response := roundTrip([]byte{sshAgentRequestIdentities})
+	messageType, _ := response.ReadByte()
+	require.Equal(t, byte(sshAgentIdentitiesAnswer), messageType)
+	var count uint32
+	require.NoError(t, binary.Read(response, binary.BigEndian, &count))
+	require.Equal(t, uint32(1), count)
+	blob, err := readSSHString(response)
+	require.NoError(t, err)
+	require.Equal(t, sshKeyBlob(key.Public().(ed25519.PublicKey)), blob)
+	comment, err := readSSHString(response)
+	require.NoError(t, err)
+	require.Equal(t, "github.com", string(comment))
+
+	var request bytes.Buffer
+	request.WriteByte(sshAgentSignRequest)
+	writeSSHString(&request, blob)
+	writeSSHString(&request, []byte("session data"))
+	binary.Write(&request, binary.BigEndian, uint32(0))
+	response = roundTrip(request.Bytes())
+	messageType, _ = response.ReadByte()
+	require.Equal(t, byte(sshAgentSignResponse), messageType)
+	signatureBlob, err := readSSHString(response)
+	require.NoError(t, err)
+	signature := bytes.NewReader(signatureBlob)
+	format, err := readSSHString(signature)
+	require.NoError(t, err)
+	require.Equal(t, "ssh-ed25519", string(format))
+	sig, err := readSSHString(signature)
+	require.NoError(t, err)
+	require.True(t, ed25519.Verify(key.Public().(ed25519.PublicKey), []byte("session data"), sig))
+
+	request.Reset()
+	request.WriteByte(sshAgentSignRequest)
+	writeSSHString(&request, []byte("unknown key"))
+	writeSSHString(&request, []byte("session data"))
+	response = roundTrip(request.Bytes())
+	messageType, _ = response.ReadByte()
+	require.Equal(t, byte(sshAgentFailure), messageType)
+
+	response = roundTrip([]byte{17})
+	messageType, _ = response.ReadByte()
+	require.Equal(t, byte(sshAgentFailure), messageType)
+}
@@ -0,0 +1,330 @@
+package mpw
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Master password strength
+//
+// Site passwords are as strong as their result type, but all of them fall
+// with the master password. Its strength is estimated the way zxcvbn does:
+// the password is split into the sequence of dictionary words, keyboard
+// walks, repeats, sequences, years, dates and brute forced runs that takes
+// the fewest guesses to find, given that an attacker tries short sequences
+// of likely parts first.
+//
+// ´´´
+// guesses = MIN( LEN( sequence )! * PRODUCT( guesses( part ) ) + 10000 ^ ( LEN( sequence ) - 1 ) )
+// ´´´
+//
+// The score from 0 to 4 puts the guesses in the ranges below 10^3, 10^6,
+// 10^8, 10^10 and above.
+type PasswordStrength struct {
+	Guesses float64
+	Score   int
+	// Sequence are the parts the password was guessed as.
+	Sequence []StrengthMatch
+}
+
+const (
+	bruteforceCardinality         = 10
+	minGuessesBeforeGrowingSeq    = 10000
+	minSubmatchGuessesSingleChar  = 10
+	minSubmatchGuessesMultiChar   = 50
+	minYearSpace                  = 20
+	maxEstimatedPasswordCharacter = 256
+)
+
+// EstimateStrength estimates the guesses needed to find password. The
+// userInputs, such as the full name, are guessed first.
+func EstimateStrength(password string, userInputs []string) PasswordStrength {
+	runes := []rune(password)
+	if len(runes) > maxEstimatedPasswordCharacter {
+		runes = runes[:maxEstimatedPasswordCharacter]
+	}
+	var inputs []string
+	for _, input := range userInputs {
+		input = strings.ToLower(input)
+		inputs = append(inputs, input)
+		inputs = append(inputs, strings.Fields(input)...)
+	}
+	strength := mostGuessableSequence(runes, omnimatch(runes, rankWords(inputs)))
+	strength.Score = strengthScore(strength.Guesses)
+	return strength
+}
+
+func strengthScore(guesses float64) int {
+	const delta = 5
+	switch {
+	case guesses < 1e3+delta:
+		return 0
+	case guesses < 1e6+delta:
+		return 1
+	case guesses < 1e8+delta:
+		return 2
+	case guesses < 1e10+delta:
+		return 3
+	}
+	return 4
+}
+
+// mostGuessableSequence finds the sequence of non-overlapping matches,
+// with brute forced runs between them, that takes the fewest guesses.
+// optimal[k][l] is the best sequence of l matches that ends at k.
+func mostGuessableSequence(password []rune, matches []StrengthMatch) PasswordStrength {
+	n := len(password)
+	if n == 0 {
+		return PasswordStrength{Guesses: 1}
+	}
+	type candidate struct {
+		match StrengthMatch
+		pi    float64
+		g     float64
+	}
+	optimal := make([]map[int]candidate, n)
+	for k := range optimal {
+		optimal[k] = map[int]candidate{}
+	}
+	update := func(match StrengthMatch, l int) {
+		k := match.j
+		match.Guesses = estimateGuesses(match, n)
+		pi := match.Guesses
+		if l > 1 {
+			pi *= optimal[match.i-1][l-1].pi
+		}
+		g := factorial(l)*pi + math.Pow(minGuessesBeforeGrowingSeq, float64(l-1))
+		for competingL, competing := range optimal[k] {
+			if competingL <= l && competing.g <= g {
+				return
+			}
+		}
+		optimal[k][l] = candidate{match: match, pi: pi, g: g}
+	}
+	bruteforce := func(i, j int) StrengthMatch {
+		return StrengthMatch{Pattern: "bruteforce", Token: string(password[i : j+1]), i: i, j: j}
+	}
+	byEnd := make([][]StrengthMatch, n)
+	for _, match := range matches {
+		byEnd[match.j] = append(byEnd[match.j], match)
+	}
+	for k := 0; k < n; k++ {
+		for _, match := range byEnd[k] {
+			if match.i == 0 {
+				update(match, 1)
+				continue
+			}
+			for l := range optimal[match.i-1] {
+				update(match, l+1)
+			}
+		}
+		update(bruteforce(0, k), 1)
+		for i := 1; i <= k; i++ {
+			for l, last := range optimal[i-1] {
+				if last.match.Pattern != "bruteforce" {
+					update(bruteforce(i, k), l+1)
+				}
+			}
+		}
+	}
+
+	l, g := 0, math.Inf(1)
+	for candidateL, candidate := range optimal[n-1] {
+		if candidate.g < g || (candidate.g == g && candidateL < l) {
+			l, g = candidateL, candidate.g
+		}
+	}
+	sequence := make([]StrengthMatch, l)
+	for k := n - 1; k >= 0; l-- {
+		match := optimal[k][l].match
+		sequence[l-1] = match
+		k = match.i - 1
+	}
+	return PasswordStrength{Guesses: g, Sequence: sequence}
+}
+
+// estimateGuesses estimates the guesses of match in a password of n
+// characters. Parts of a password take at least a few guesses, as the
+// attacker does not know where they start.
+func estimateGuesses(match StrengthMatch, n int) float64 {
+	length := len([]rune(match.Token))
+	minGuesses := 1.0
+	if length < n {
+		minGuesses = minSubmatchGuessesMultiChar
+		if length == 1 {
+			minGuesses = minSubmatchGuessesSingleChar
+		}
+	}
+	var guesses float64
+	switch match.Pattern {
+	case "bruteforce":
+		guesses = math.Pow(bruteforceCardinality, float64(length))
+		if math.IsInf(guesses, 1) {
+			guesses = math.MaxFloat64
+		}
+		minBruteforce := float64(minSubmatchGuessesMultiChar + 1)
+		if length == 1 {
+			minBruteforce = minSubmatchGuessesSingleChar + 1
+		}
+		guesses = math.Max(guesses, minBruteforce)
+	case "dictionary":
+		guesses = float64(match.rank) * uppercaseVariations(match.Token) * l33tVariations(match)
+		if match.reversed {
+			guesses *= 2
+		}
+	case "spatial":
+		guesses = spatialGuesses(match)
+	case "repeat":
+		guesses = match.baseGuesses * float64(match.repeatCount)
+	case "sequence":
+		first := []rune(match.Token)[0]
+		base := 26.0
+		switch {
+		case strings.ContainsRune("aAzZ019", first):
+			base = 4
+		case unicode.IsDigit(first):
+			base = 10
+		}
+		if !match.ascending {
+			base *= 2
+		}
+		guesses = base * float64(length)
+	case "regex":
+		guesses = yearSpace(match.year)
+	case "date":
+		guesses = yearSpace(match.year) * 365
+		if match.separator {
+			guesses *= 4
+		}
+	}
+	return math.Max(guesses, minGuesses)
+}
+
+// referenceYear is the year that years and dates are guessed around.
+func referenceYear() int {
+	return time.Now().Year()
+}
+
+func yearSpace(year int) float64 {
+	return math.Max(float64(abs(year-referenceYear())), minYearSpace)
+}
+
+// uppercaseVariations counts the ways to capitalize a word like token.
+// Capitalizing the first or the last letter or all of them is common.
+func uppercaseVariations(token string) float64 {
+	upper, lower := 0, 0
+	for _, r := range token {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	runes := []rune(token)
+	switch {
+	case upper == 0:
+		return 1
+	case lower == 0:
+		return 2
+	case upper == 1 && unicode.IsUpper(runes[0]):
+		return 2
+	case upper == 1 && unicode.IsUpper(runes[len(runes)-1]):
+		return 2
+	}
+	return partialChoices(upper, lower)
+}
+
+// l33tVariations counts the ways to substitute the letters of a word like
+// match does.
+func l33tVariations(match StrengthMatch) float64 {
+	if !match.l33t {
+		return 1
+	}
+	variations := 1.0
+	lower := lowerRunes([]rune(match.Token))
+	for subbed, letter := range match.sub {
+		s, u := 0, 0
+		for _, r := range lower {
+			switch r {
+			case subbed:
+				s++
+			case letter:
+				u++
+			}
+		}
+		if s == 0 || u == 0 {
+			variations *= 2
+			continue
+		}
+		variations *= partialChoices(s, u)
+	}
+	return variations
+}
+
+// partialChoices is the number of ways to pick up to MIN( a, b ) of a + b
+// characters.
+func partialChoices(a, b int) float64 {
+	choices := 0.0
+	for i := 1; i <= a && i <= b; i++ {
+		choices += binomial(a+b, i)
+	}
+	return choices
+}
+
+// spatialGuesses counts the keyboard walks of the same length with up to
+// as many turns, times the ways to press shift.
+func spatialGuesses(match StrengthMatch) float64 {
+	var graph keyboardGraph
+	for _, g := range keyboardGraphs() {
+		if g.name == match.Graph {
+			graph = g
+		}
+	}
+	length := len([]rune(match.Token))
+	guesses := 0.0
+	for i := 2; i <= length; i++ {
+		for j := 1; j <= match.turns && j <= i-1; j++ {
+			guesses += binomial(i-1, j-1) * graph.startingPositions * math.Pow(graph.averageDegree, float64(j))
+		}
+	}
+	if match.shiftedCount > 0 {
+		shifted, unshifted := match.shiftedCount, length-match.shiftedCount
+		if shifted == 0 || unshifted == 0 {
+			guesses *= 2
+		} else {
+			guesses *= partialChoices(shifted, unshifted)
+		}
+	}
+	return guesses
+}
+
+func binomial(n, k int) float64 {
+	if k > n {
+		return 0
+	}
+	result := 1.0
+	for d := 1; d <= k; d++ {
+		result = result * float64(n-k+d) / float64(d)
+	}
+	return math.Round(result)
+}
+
+func factorial(n int) float64 {
+	result := 1.0
+	for i := 2; i <= n; i++ {
+		result *= float64(i)
+	}
+	return result
+}
+
+// Cracking the master password
+//
+// An attacker who knows the full name and a single site password can test
+// master passwords offline, at the price of one master key per guess. A
+// high end GPU computes about 5000 master keys per second with the scrypt
+// parameters N = 16384, r = 8 and p = 1, and the cost grows with N * r * p.
+// MasterKeyGuessesPerSecond assumes a rig of 20 such GPUs.
+const MasterKeyGuessesPerSecond = 20 * 5000 * 16384 * 8 * 1 / (scryptN * scryptR * scryptP)
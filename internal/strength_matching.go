@@ -0,0 +1,661 @@
+package mpw
+
+import (
+	"embed"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// The frequency lists of zxcvbn, https://github.com/dropbox/zxcvbn,
+// licensed under the MIT license by Dropbox, Inc., most common first.
+//
+//go:embed frequency/*.txt
+var frequencyLists embed.FS
+
+var (
+	dictionariesOnce sync.Once
+	dictionaries     map[string]map[string]int
+)
+
+// rankedDictionaries parses the embedded frequency lists on first use into
+// the rank of every word, starting at 1.
+func rankedDictionaries() map[string]map[string]int {
+	dictionariesOnce.Do(func() {
+		dictionaries = map[string]map[string]int{}
+		for _, name := range []string{"passwords", "english", "female_names", "male_names", "surnames"} {
+			b, err := frequencyLists.ReadFile("frequency/" + name + ".txt")
+			if err != nil {
+				panic(err)
+			}
+			dictionaries[name] = rankWords(strings.Split(strings.TrimSpace(string(b)), "\n"))
+		}
+	})
+	return dictionaries
+}
+
+func rankWords(words []string) map[string]int {
+	ranks := make(map[string]int, len(words))
+	for i, word := range words {
+		if _, found := ranks[word]; !found {
+			ranks[word] = i + 1
+		}
+	}
+	return ranks
+}
+
+// StrengthMatch is a part of a password that an attacker would guess as a
+// whole, found by one of the patterns.
+type StrengthMatch struct {
+	// Pattern is one of dictionary, spatial, repeat, sequence, regex, date
+	// and bruteforce.
+	Pattern string
+	Token   string
+	Guesses float64
+	// Dictionary is the list a dictionary match was found in, Graph the
+	// keyboard of a spatial match.
+	Dictionary string
+	Graph      string
+
+	i, j int
+
+	rank     int
+	word     string
+	reversed bool
+	l33t     bool
+	sub      map[rune]rune
+
+	turns        int
+	shiftedCount int
+
+	baseGuesses float64
+	repeatCount int
+
+	ascending bool
+
+	year      int
+	separator bool
+}
+
+// omnimatch finds every match of every pattern in password.
+func omnimatch(password []rune, userDictionary map[string]int) []StrengthMatch {
+	ranked := map[string]map[string]int{}
+	for name, ranks := range rankedDictionaries() {
+		ranked[name] = ranks
+	}
+	if len(userDictionary) > 0 {
+		ranked["user_inputs"] = userDictionary
+	}
+	var matches []StrengthMatch
+	matches = append(matches, dictionaryMatches(password, ranked)...)
+	matches = append(matches, reverseDictionaryMatches(password, ranked)...)
+	matches = append(matches, l33tMatches(password, ranked)...)
+	matches = append(matches, spatialMatches(password)...)
+	matches = append(matches, repeatMatches(password, userDictionary)...)
+	matches = append(matches, sequenceMatches(password)...)
+	matches = append(matches, yearMatches(password)...)
+	matches = append(matches, dateMatches(password)...)
+	sort.SliceStable(matches, func(a, b int) bool {
+		if matches[a].i != matches[b].i {
+			return matches[a].i < matches[b].i
+		}
+		return matches[a].j < matches[b].j
+	})
+	return matches
+}
+
+func lowerRunes(password []rune) []rune {
+	lower := make([]rune, len(password))
+	for i, r := range password {
+		lower[i] = unicode.ToLower(r)
+	}
+	return lower
+}
+
+func dictionaryMatches(password []rune, ranked map[string]map[string]int) []StrengthMatch {
+	lower := lowerRunes(password)
+	names := make([]string, 0, len(ranked))
+	for name := range ranked {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var matches []StrengthMatch
+	for _, name := range names {
+		for i := range lower {
+			for j := i; j < len(lower); j++ {
+				word := string(lower[i : j+1])
+				if rank, found := ranked[name][word]; found {
+					matches = append(matches, StrengthMatch{
+						Pattern:    "dictionary",
+						Token:      string(password[i : j+1]),
+						Dictionary: name,
+						i:          i,
+						j:          j,
+						rank:       rank,
+						word:       word,
+					})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+func reverseDictionaryMatches(password []rune, ranked map[string]map[string]int) []StrengthMatch {
+	n := len(password)
+	reversed := make([]rune, n)
+	for i, r := range password {
+		reversed[n-1-i] = r
+	}
+	matches := dictionaryMatches(reversed, ranked)
+	for k := range matches {
+		i, j := n-1-matches[k].j, n-1-matches[k].i
+		matches[k].i, matches[k].j = i, j
+		matches[k].Token = string(password[i : j+1])
+		matches[k].reversed = true
+	}
+	return matches
+}
+
+// l33tTable lists the characters that stand in for letters.
+var l33tTable = map[rune][]rune{
+	'a': []rune("4@"),
+	'b': []rune("8"),
+	'c': []rune("({[<"),
+	'e': []rune("3"),
+	'g': []rune("69"),
+	'i': []rune("1!|"),
+	'l': []rune("1|7"),
+	'o': []rune("0"),
+	's': []rune("$5"),
+	't': []rune("+7"),
+	'x': []rune("%"),
+	'z': []rune("2"),
+}
+
+// l33tSubs enumerates the ways the characters of password could stand in
+// for letters, each character for one letter at a time.
+func l33tSubs(password []rune) []map[rune]rune {
+	candidates := map[rune][]rune{}
+	for letter, subs := range l33tTable {
+		for _, sub := range subs {
+			for _, r := range password {
+				if r == sub {
+					candidates[sub] = append(candidates[sub], letter)
+					break
+				}
+			}
+		}
+	}
+	subbed := make([]rune, 0, len(candidates))
+	for sub := range candidates {
+		subbed = append(subbed, sub)
+		sort.Slice(candidates[sub], func(a, b int) bool { return candidates[sub][a] < candidates[sub][b] })
+	}
+	sort.Slice(subbed, func(a, b int) bool { return subbed[a] < subbed[b] })
+	subs := []map[rune]rune{{}}
+	for _, sub := range subbed {
+		var next []map[rune]rune
+		for _, s := range subs {
+			for _, letter := range candidates[sub] {
+				extended := map[rune]rune{sub: letter}
+				for k, v := range s {
+					extended[k] = v
+				}
+				next = append(next, extended)
+			}
+		}
+		subs = next
+	}
+	if len(subbed) == 0 {
+		return nil
+	}
+	return subs
+}
+
+func l33tMatches(password []rune, ranked map[string]map[string]int) []StrengthMatch {
+	var matches []StrengthMatch
+	for _, sub := range l33tSubs(password) {
+		translated := make([]rune, len(password))
+		for i, r := range password {
+			if letter, found := sub[r]; found {
+				r = letter
+			}
+			translated[i] = r
+		}
+		for _, match := range dictionaryMatches(translated, ranked) {
+			token := password[match.i : match.j+1]
+			if len(token) <= 1 || string(lowerRunes(token)) == match.word {
+				continue
+			}
+			used := map[rune]rune{}
+			for _, r := range token {
+				if letter, found := sub[r]; found {
+					used[r] = letter
+				}
+			}
+			match.Token = string(token)
+			match.l33t = true
+			match.sub = used
+			matches = append(matches, match)
+		}
+	}
+	return matches
+}
+
+// Keyboard layouts, the keys of every row with their shifted characters.
+// The rows of the qwerty keyboard are each shifted half a key to the right
+// of the row above.
+const (
+	qwertyLayout = `
+` + "`~" + ` 1! 2@ 3# 4$ 5% 6^ 7& 8* 9( 0) -_ =+
+    qQ wW eE rR tT yY uU iI oO pP [{ ]} \|
+     aA sS dD fF gG hH jJ kK lL ;: '"
+      zZ xX cC vV bB nN mM ,< .> /?
+`
+	keypadLayout = `
+  / * -
+7 8 9 +
+4 5 6
+1 2 3
+  0 .
+`
+)
+
+type keyboardGraph struct {
+	name string
+	// neighbours are the keys around every character, clockwise from the
+	// left, nil where there is no key.
+	neighbours map[rune][][]rune
+	// startingPositions and averageDegree describe the keyboard to the
+	// guess estimate.
+	startingPositions float64
+	averageDegree     float64
+}
+
+var (
+	keyboardsOnce sync.Once
+	keyboards     []keyboardGraph
+)
+
+func keyboardGraphs() []keyboardGraph {
+	keyboardsOnce.Do(func() {
+		keyboards = []keyboardGraph{
+			buildKeyboardGraph("qwerty", qwertyLayout, true),
+			buildKeyboardGraph("keypad", keypadLayout, false),
+		}
+	})
+	return keyboards
+}
+
+// buildKeyboardGraph finds the neighbours of every key of layout. Keys of
+// slanted keyboards have six neighbours, those of aligned keypads eight.
+func buildKeyboardGraph(name string, layout string, slanted bool) keyboardGraph {
+	type coordinate struct{ x, y int }
+	positions := map[coordinate]string{}
+	lines := strings.Split(layout, "\n")
+	keySize := len(strings.Fields(layout)[0])
+	for y, line := range lines {
+		slant := 0
+		if slanted {
+			slant = y - 1
+		}
+		offset := 0
+		for _, key := range strings.Fields(line) {
+			index := strings.Index(line[offset:], key) + offset
+			offset = index + len(key)
+			positions[coordinate{(index - slant) / (keySize + 1), y}] = key
+		}
+	}
+	adjacent := func(x, y int) []coordinate {
+		if slanted {
+			return []coordinate{{x - 1, y}, {x, y - 1}, {x + 1, y - 1}, {x + 1, y}, {x, y + 1}, {x - 1, y + 1}}
+		}
+		return []coordinate{{x - 1, y}, {x - 1, y - 1}, {x, y - 1}, {x + 1, y - 1}, {x + 1, y}, {x + 1, y + 1}, {x, y + 1}, {x - 1, y + 1}}
+	}
+	graph := keyboardGraph{name: name, neighbours: map[rune][][]rune{}}
+	degrees := 0
+	for position, key := range positions {
+		for _, r := range key {
+			for _, c := range adjacent(position.x, position.y) {
+				neighbour, found := positions[c]
+				if !found {
+					graph.neighbours[r] = append(graph.neighbours[r], nil)
+					continue
+				}
+				graph.neighbours[r] = append(graph.neighbours[r], []rune(neighbour))
+				degrees++
+			}
+		}
+	}
+	graph.startingPositions = float64(len(graph.neighbours))
+	graph.averageDegree = float64(degrees) / graph.startingPositions
+	return graph
+}
+
+// shiftedCharacters are typed with shift on the qwerty keyboard.
+const shiftedCharacters = "~!@#$%^&*()_+QWERTYUIOP{}|ASDFGHJKL:\"ZXCVBNM<>?"
+
+func spatialMatches(password []rune) []StrengthMatch {
+	var matches []StrengthMatch
+	for _, graph := range keyboardGraphs() {
+		i := 0
+		for i < len(password)-1 {
+			j := i + 1
+			lastDirection := -1
+			turns := 0
+			shiftedCount := 0
+			if graph.name == "qwerty" && strings.ContainsRune(shiftedCharacters, password[i]) {
+				shiftedCount = 1
+			}
+			for {
+				found := false
+				if j < len(password) {
+					for direction, neighbour := range graph.neighbours[password[j-1]] {
+						index := runeIndex(neighbour, password[j])
+						if index < 0 {
+							continue
+						}
+						found = true
+						if index == 1 {
+							shiftedCount++
+						}
+						if lastDirection != direction {
+							turns++
+							lastDirection = direction
+						}
+						break
+					}
+				}
+				if found {
+					j++
+					continue
+				}
+				if j-i > 2 {
+					matches = append(matches, StrengthMatch{
+						Pattern:      "spatial",
+						Token:        string(password[i:j]),
+						Graph:        graph.name,
+						i:            i,
+						j:            j - 1,
+						turns:        turns,
+						shiftedCount: shiftedCount,
+					})
+				}
+				i = j
+				break
+			}
+		}
+	}
+	return matches
+}
+
+func runeIndex(runes []rune, r rune) int {
+	for i, c := range runes {
+		if c == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// repeatMatches finds runs of a repeated base, at every position the run
+// covering the most characters with the shortest base.
+func repeatMatches(password []rune, userDictionary map[string]int) []StrengthMatch {
+	var matches []StrengthMatch
+	i := 0
+	for i < len(password) {
+		bestBase, bestCount := 0, 0
+		for base := 1; i+2*base <= len(password); base++ {
+			count := 1
+			for i+(count+1)*base <= len(password) && string(password[i+count*base:i+(count+1)*base]) == string(password[i:i+base]) {
+				count++
+			}
+			if count >= 2 && base*count > bestBase*bestCount {
+				bestBase, bestCount = base, count
+			}
+		}
+		if bestCount == 0 {
+			i++
+			continue
+		}
+		// A base that repeats itself, as in abababab, is guessed by its
+		// own shortest base.
+		base := password[i : i+bestBase]
+		for b := 1; b < len(base); b++ {
+			if len(base)%b == 0 && string(base) == strings.Repeat(string(base[:b]), len(base)/b) {
+				bestCount *= len(base) / b
+				base = base[:b]
+				break
+			}
+		}
+		baseGuesses := mostGuessableSequence(base, omnimatch(base, userDictionary)).Guesses
+		matches = append(matches, StrengthMatch{
+			Pattern:     "repeat",
+			Token:       string(password[i : i+len(base)*bestCount]),
+			i:           i,
+			j:           i + len(base)*bestCount - 1,
+			baseGuesses: baseGuesses,
+			repeatCount: bestCount,
+		})
+		i += len(base) * bestCount
+	}
+	return matches
+}
+
+// maxSequenceDelta is the largest step between the characters of a
+// sequence such as abcdef or 97531.
+const maxSequenceDelta = 5
+
+func sequenceMatches(password []rune) []StrengthMatch {
+	if len(password) <= 1 {
+		return nil
+	}
+	var matches []StrengthMatch
+	update := func(i, j int, delta int) {
+		if j-i > 1 || delta == 1 || delta == -1 {
+			if delta != 0 && delta >= -maxSequenceDelta && delta <= maxSequenceDelta {
+				matches = append(matches, StrengthMatch{
+					Pattern:   "sequence",
+					Token:     string(password[i : j+1]),
+					i:         i,
+					j:         j,
+					ascending: delta > 0,
+				})
+			}
+		}
+	}
+	i := 0
+	lastDelta := int(password[1] - password[0])
+	for k := 1; k < len(password); k++ {
+		delta := int(password[k] - password[k-1])
+		if delta == lastDelta {
+			continue
+		}
+		update(i, k-1, lastDelta)
+		i = k - 1
+		lastDelta = delta
+	}
+	update(i, len(password)-1, lastDelta)
+	return matches
+}
+
+// yearMatches finds years of the last and the current century.
+func yearMatches(password []rune) []StrengthMatch {
+	var matches []StrengthMatch
+	for i := 0; i+4 <= len(password); i++ {
+		token := string(password[i : i+4])
+		if !allDigits(password[i:i+4]) || !(strings.HasPrefix(token, "19") || strings.HasPrefix(token, "20")) {
+			continue
+		}
+		year, _ := strconv.Atoi(token)
+		matches = append(matches, StrengthMatch{Pattern: "regex", Token: token, i: i, j: i + 3, year: year})
+		i += 3
+	}
+	return matches
+}
+
+func allDigits(runes []rune) bool {
+	for _, r := range runes {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return len(runes) > 0
+}
+
+// dateSplits are the ways to split a date without separators into day,
+// month and year, by the length of the date.
+var dateSplits = map[int][][2]int{
+	4: {{1, 2}, {2, 3}},
+	5: {{1, 3}, {2, 3}},
+	6: {{1, 2}, {2, 4}, {4, 5}},
+	7: {{1, 3}, {2, 3}, {4, 5}, {4, 6}},
+	8: {{2, 4}, {4, 6}},
+}
+
+const (
+	dateMinYear = 1000
+	dateMaxYear = 2050
+)
+
+func dateMatches(password []rune) []StrengthMatch {
+	var matches []StrengthMatch
+	for i := range password {
+		for j := i + 3; j < i+8 && j < len(password); j++ {
+			token := password[i : j+1]
+			if !allDigits(token) {
+				continue
+			}
+			best, found := 0, false
+			for _, split := range dateSplits[len(token)] {
+				ints := [3]int{}
+				ints[0], _ = strconv.Atoi(string(token[:split[0]]))
+				ints[1], _ = strconv.Atoi(string(token[split[0]:split[1]]))
+				ints[2], _ = strconv.Atoi(string(token[split[1]:]))
+				year, ok := dateYear(ints)
+				if ok && (!found || abs(year-referenceYear()) < abs(best-referenceYear())) {
+					best, found = year, true
+				}
+			}
+			if found {
+				matches = append(matches, StrengthMatch{Pattern: "date", Token: string(token), i: i, j: j, year: best})
+			}
+		}
+	}
+	for i := range password {
+		for j := i + 5; j < i+10 && j < len(password); j++ {
+			token := password[i : j+1]
+			ints, separator, ok := separatedDate(token)
+			if !ok {
+				continue
+			}
+			if year, ok := dateYear(ints); ok {
+				matches = append(matches, StrengthMatch{Pattern: "date", Token: string(token), i: i, j: j, year: year, separator: separator != 0})
+			}
+		}
+	}
+	// Dates inside longer dates are not guessed on their own.
+	var outer []StrengthMatch
+	for _, match := range matches {
+		contained := false
+		for _, other := range matches {
+			if (other.i != match.i || other.j != match.j) && other.i <= match.i && other.j >= match.j {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			outer = append(outer, match)
+		}
+	}
+	return outer
+}
+
+// separatedDate splits token in the form 1-4 digits, separator, 1-2
+// digits, the same separator, 1-4 digits.
+func separatedDate(token []rune) ([3]int, rune, bool) {
+	var ints [3]int
+	var separator rune
+	part, digits := 0, 0
+	for _, r := range token {
+		switch {
+		case r >= '0' && r <= '9':
+			ints[part] = ints[part]*10 + int(r-'0')
+			digits++
+		case strings.ContainsRune(" /\\_.-", r) && part < 2 && digits > 0 && (separator == 0 || separator == r):
+			separator = r
+			part++
+			digits = 0
+			continue
+		default:
+			return ints, 0, false
+		}
+		limit := 4
+		if part == 1 {
+			limit = 2
+		}
+		if digits > limit {
+			return ints, 0, false
+		}
+	}
+	return ints, separator, part == 2 && digits > 0
+}
+
+// dateYear finds a valid day, month and year in ints and returns the year.
+func dateYear(ints [3]int) (int, bool) {
+	if ints[1] > 31 || ints[1] <= 0 {
+		return 0, false
+	}
+	over12, over31, under1 := 0, 0, 0
+	for _, n := range ints {
+		if (n > 99 && n < dateMinYear) || n > dateMaxYear {
+			return 0, false
+		}
+		if n > 31 {
+			over31++
+		}
+		if n > 12 {
+			over12++
+		}
+		if n <= 0 {
+			under1++
+		}
+	}
+	if over31 >= 2 || over12 == 3 || under1 >= 2 {
+		return 0, false
+	}
+	splits := [][3]int{{ints[2], ints[0], ints[1]}, {ints[0], ints[1], ints[2]}}
+	for _, split := range splits {
+		if split[0] >= dateMinYear && split[0] <= dateMaxYear {
+			return split[0], validDayMonth(split[1], split[2])
+		}
+	}
+	for _, split := range splits {
+		if validDayMonth(split[1], split[2]) {
+			year := split[0]
+			switch {
+			case year > 99:
+			case year > 50:
+				year += 1900
+			default:
+				year += 2000
+			}
+			return year, true
+		}
+	}
+	return 0, false
+}
+
+func validDayMonth(a, b int) bool {
+	return (a >= 1 && a <= 31 && b >= 1 && b <= 12) || (b >= 1 && b <= 31 && a >= 1 && a <= 12)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,55 @@
+package mpw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateStrength(t *testing.T) {
+	for password, pattern := range map[string]string{
+		"password":     "dictionary",
+		"P@ssw0rd":     "dictionary",
+		"drowssap":     "dictionary",
+		"zxcvfdsa":     "spatial",
+		"aaaaaaaaaaaa": "repeat",
+		"abcdefghijk":  "sequence",
+		"13/05/1987":   "date",
+	} {
+		strength := EstimateStrength(password, nil)
+		require.Len(t, strength.Sequence, 1, password)
+		require.Equal(t, pattern, strength.Sequence[0].Pattern, password)
+		require.Equal(t, password, strength.Sequence[0].Token, password)
+		require.LessOrEqual(t, strength.Score, 1, password)
+	}
+
+	strength := EstimateStrength("", nil)
+	require.Equal(t, 0, strength.Score)
+	require.Equal(t, 1.0, strength.Guesses)
+
+	strength = EstimateStrength("rWibMFACxAUGZmxhVncy", nil)
+	require.Equal(t, 4, strength.Score)
+	require.Equal(t, 1e20, strength.Guesses)
+
+	// The full name is guessed first.
+	withoutName := EstimateStrength("vexmarkzorbulon", nil)
+	withName := EstimateStrength("vexmarkzorbulon", []string{"Zorbulon Vexmark"})
+	require.Less(t, withName.Guesses, withoutName.Guesses)
+	require.Equal(t, "user_inputs", withName.Sequence[0].Dictionary)
+
+	// Capitals and substitutions make a word only slightly harder to guess.
+	plain := EstimateStrength("monkey", nil)
+	variant := EstimateStrength("M0nkey", nil)
+	require.Greater(t, variant.Guesses, plain.Guesses)
+	require.Less(t, variant.Guesses, 10*plain.Guesses)
+}
+
+func TestKeyboardGraphs(t *testing.T) {
+	qwerty := keyboardGraphs()[0]
+	require.Len(t, qwerty.neighbours, 94)
+	require.Equal(t, [][]rune{nil, []rune("1!"), []rune("2@"), []rune("wW"), []rune("aA"), nil}, qwerty.neighbours['q'])
+	require.Equal(t, [][]rune{[]rune("gG"), []rune("yY"), []rune("uU"), []rune("jJ"), []rune("nN"), []rune("bB")}, qwerty.neighbours['H'])
+	keypad := keyboardGraphs()[1]
+	require.Len(t, keypad.neighbours, 15)
+	require.Equal(t, [][]rune{[]rune("4"), []rune("7"), []rune("8"), []rune("9"), []rune("6"), []rune("3"), []rune("2"), []rune("1")}, keypad.neighbours['5'])
+}
@@ -0,0 +1,306 @@
+package mpw
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Vaults
+//
+// Sites are exchanged with other password managers as vault entries, with
+// their derived login names and passwords. Besides KeePass databases they
+// are written and read in the unencrypted export formats of Bitwarden and
+// 1Password, which those import as well:
+//
+// ´´´
+// bitwarden-json = { "encrypted": false, "folders": [ folder* ], "items": [ item* ] }
+// bitwarden-csv = folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp
+// 1password-csv = Title,Url,Username,Password,OTPAuth,Favorite,Archived,Tags,Notes
+// ´´´
+//
+// Bitwarden keeps an entry in one folder, the first of its tags.
+
+// VaultEntry is a login of a password manager.
+type VaultEntry struct {
+	Title    string
+	UserName string
+	Password string
+	URL      string
+	Notes    string
+	// Tags are the groups of the entry, it is put in the first.
+	Tags []string
+}
+
+type VaultFormat string
+
+const (
+	BitwardenJSON  VaultFormat = "bitwarden-json"
+	BitwardenCSV   VaultFormat = "bitwarden-csv"
+	OnePasswordCSV VaultFormat = "1password-csv"
+)
+
+// VaultFormats are the formats WriteVault and ReadVault support.
+var VaultFormats = []VaultFormat{BitwardenJSON, BitwardenCSV, OnePasswordCSV}
+
+// WriteVault writes entries in format.
+func WriteVault(w io.Writer, format VaultFormat, entries []VaultEntry) error {
+	switch format {
+	case BitwardenJSON:
+		return writeBitwardenJSON(w, entries)
+	case BitwardenCSV:
+		return writeVaultCSV(w, bitwardenCSVHeader, entries, func(entry VaultEntry) []string {
+			return []string{firstTag(entry), "", "login", entry.Title, entry.Notes, "", "0", entry.URL, entry.UserName, entry.Password, ""}
+		})
+	case OnePasswordCSV:
+		return writeVaultCSV(w, onePasswordCSVHeader, entries, func(entry VaultEntry) []string {
+			return []string{entry.Title, entry.URL, entry.UserName, entry.Password, "", "false", "false", strings.Join(entry.Tags, ";"), entry.Notes}
+		})
+	}
+	return fmt.Errorf("vault format not supported: %s", format)
+}
+
+// ReadVault reads the entries of a vault in format. Entries that are not
+// logins, like Bitwarden's cards and secure notes, are skipped.
+func ReadVault(r io.Reader, format VaultFormat) ([]VaultEntry, error) {
+	switch format {
+	case BitwardenJSON:
+		return readBitwardenJSON(r)
+	case BitwardenCSV:
+		return readVaultCSV(r, func(row map[string]string) (VaultEntry, bool) {
+			uri, _, _ := strings.Cut(row["login_uri"], ",")
+			entry := VaultEntry{Title: row["name"], UserName: row["login_username"], Password: row["login_password"], URL: uri, Notes: row["notes"]}
+			if row["folder"] != "" {
+				entry.Tags = []string{row["folder"]}
+			}
+			return entry, row["type"] == "" || row["type"] == "login"
+		})
+	case OnePasswordCSV:
+		return readVaultCSV(r, func(row map[string]string) (VaultEntry, bool) {
+			url := row["url"]
+			if url == "" {
+				url = row["website"]
+			}
+			entry := VaultEntry{Title: row["title"], UserName: row["username"], Password: row["password"], URL: url, Notes: row["notes"]}
+			for _, tag := range strings.Split(row["tags"], ";") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					entry.Tags = append(entry.Tags, tag)
+				}
+			}
+			return entry, true
+		})
+	}
+	return nil, fmt.Errorf("vault format not supported: %s", format)
+}
+
+var (
+	bitwardenCSVHeader   = []string{"folder", "favorite", "type", "name", "notes", "fields", "reprompt", "login_uri", "login_username", "login_password", "login_totp"}
+	onePasswordCSVHeader = []string{"Title", "Url", "Username", "Password", "OTPAuth", "Favorite", "Archived", "Tags", "Notes"}
+)
+
+func writeVaultCSV(w io.Writer, header []string, entries []VaultEntry, record func(VaultEntry) []string) error {
+	out := csv.NewWriter(w)
+	out.Write(header)
+	for _, entry := range entries {
+		out.Write(record(entry))
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// readVaultCSV reads the rows of a CSV file by the lower case names in its
+// header, so that the order of the columns does not matter.
+func readVaultCSV(r io.Reader, entry func(row map[string]string) (VaultEntry, bool)) ([]VaultEntry, error) {
+	in := csv.NewReader(r)
+	in.FieldsPerRecord = -1
+	header, err := in.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+	}
+	var entries []VaultEntry
+	for {
+		record, err := in.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := map[string]string{}
+		for i, value := range record {
+			if i < len(header) {
+				row[header[i]] = value
+			}
+		}
+		if read, ok := entry(row); ok {
+			entries = append(entries, read)
+		}
+	}
+}
+
+type bitwardenExport struct {
+	Encrypted bool              `json:"encrypted"`
+	Folders   []bitwardenFolder `json:"folders"`
+	Items     []bitwardenItem   `json:"items"`
+}
+
+type bitwardenFolder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type bitwardenItem struct {
+	ID             string          `json:"id"`
+	OrganizationID *string         `json:"organizationId"`
+	FolderID       *string         `json:"folderId"`
+	Type           int             `json:"type"`
+	Reprompt       int             `json:"reprompt"`
+	Name           string          `json:"name"`
+	Notes          *string         `json:"notes"`
+	Favorite       bool            `json:"favorite"`
+	Login          *bitwardenLogin `json:"login,omitempty"`
+	CollectionIDs  []string        `json:"collectionIds"`
+}
+
+type bitwardenLogin struct {
+	URIs     []bitwardenURI `json:"uris"`
+	Username *string        `json:"username"`
+	Password *string        `json:"password"`
+	TOTP     *string        `json:"totp"`
+}
+
+type bitwardenURI struct {
+	Match *int   `json:"match"`
+	URI   string `json:"uri"`
+}
+
+// bitwardenLoginType is the item type of logins.
+const bitwardenLoginType = 1
+
+func writeBitwardenJSON(w io.Writer, entries []VaultEntry) error {
+	export := bitwardenExport{Folders: []bitwardenFolder{}, Items: []bitwardenItem{}}
+	folderIDs := map[string]string{}
+	for _, entry := range entries {
+		id, err := bitwardenID()
+		if err != nil {
+			return err
+		}
+		item := bitwardenItem{
+			ID:    id,
+			Type:  bitwardenLoginType,
+			Name:  entry.Title,
+			Notes: optional(entry.Notes),
+			Login: &bitwardenLogin{
+				URIs:     []bitwardenURI{},
+				Username: optional(entry.UserName),
+				Password: optional(entry.Password),
+			},
+		}
+		if entry.URL != "" {
+			item.Login.URIs = append(item.Login.URIs, bitwardenURI{URI: entry.URL})
+		}
+		if folder := firstTag(entry); folder != "" {
+			if _, found := folderIDs[folder]; !found {
+				folderIDs[folder], err = bitwardenID()
+				if err != nil {
+					return err
+				}
+				export.Folders = append(export.Folders, bitwardenFolder{ID: folderIDs[folder], Name: folder})
+			}
+			item.FolderID = optional(folderIDs[folder])
+		}
+		export.Items = append(export.Items, item)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(export)
+}
+
+func readBitwardenJSON(r io.Reader) ([]VaultEntry, error) {
+	var export bitwardenExport
+	err := json.NewDecoder(r).Decode(&export)
+	if err != nil {
+		return nil, err
+	}
+	if export.Encrypted {
+		return nil, errors.New("encrypted Bitwarden exports are not supported, export unencrypted JSON")
+	}
+	folders := map[string]string{}
+	for _, folder := range export.Folders {
+		folders[folder.ID] = folder.Name
+	}
+	var entries []VaultEntry
+	for _, item := range export.Items {
+		if item.Type != bitwardenLoginType || item.Login == nil {
+			continue
+		}
+		entry := VaultEntry{
+			Title:    item.Name,
+			UserName: stringValue(item.Login.Username),
+			Password: stringValue(item.Login.Password),
+			Notes:    stringValue(item.Notes),
+		}
+		if len(item.Login.URIs) > 0 {
+			entry.URL = item.Login.URIs[0].URI
+		}
+		if item.FolderID != nil && folders[*item.FolderID] != "" {
+			entry.Tags = []string{folders[*item.FolderID]}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func bitwardenID() (string, error) {
+	uuid, err := randomUUID()
+	if err != nil {
+		return "", err
+	}
+	s := hex.EncodeToString(uuid)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:], nil
+}
+
+// randomUUID returns a random version 4 UUID.
+func randomUUID() ([]byte, error) {
+	uuid := make([]byte, 16)
+	_, err := rand.Read(uuid)
+	if err != nil {
+		return nil, err
+	}
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return uuid, nil
+}
+
+func firstTag(entry VaultEntry) string {
+	if len(entry.Tags) == 0 {
+		return ""
+	}
+	return entry.Tags[0]
+}
+
+// optional is s, or null in JSON if it is empty.
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,47 @@
+package mpw
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaultRoundTrip(t *testing.T) {
+	entries := []VaultEntry{
+		{Title: "masterpasswordapp.com", UserName: "robert", Password: "Jejr5[RepuSosp", URL: "https://masterpasswordapp.com", Notes: "Notes, \"quoted\"\non two lines"},
+		{Title: "example.com", UserName: "wohzaqage", Password: "Feji5@ReduWosh", Tags: []string{"work"}},
+		{Title: "bank.example", Password: "1234", Tags: []string{"finance"}},
+	}
+	for _, format := range VaultFormats {
+		var file bytes.Buffer
+		require.NoError(t, WriteVault(&file, format, entries))
+		read, err := ReadVault(&file, format)
+		require.NoError(t, err)
+		require.Equal(t, entries, read, format)
+	}
+}
+
+func TestReadVault(t *testing.T) {
+	bitwarden := `folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp
+Social,1,login,Twitter,,,0,"https://twitter.com,https://x.com",me@example.com,password123,
+,,note,My note,Secret note,,0,,,,
+`
+	read, err := ReadVault(strings.NewReader(bitwarden), BitwardenCSV)
+	require.NoError(t, err)
+	require.Equal(t, []VaultEntry{
+		{Title: "Twitter", UserName: "me@example.com", Password: "password123", URL: "https://twitter.com", Tags: []string{"Social"}},
+	}, read)
+
+	onePassword := "\ufeffTitle,Username,Password,Url,Notes,Tags\nGitHub,rob,hunter2,https://github.com/login,,dev; work\n"
+	read, err = ReadVault(strings.NewReader(onePassword), OnePasswordCSV)
+	require.NoError(t, err)
+	require.Equal(t, []VaultEntry{
+		{Title: "GitHub", UserName: "rob", Password: "hunter2", URL: "https://github.com/login", Tags: []string{"dev", "work"}},
+	}, read)
+
+	_, err = ReadVault(strings.NewReader(`{"encrypted": true, "items": []}`), BitwardenJSON)
+	require.Error(t, err)
+	require.Error(t, WriteVault(&bytes.Buffer{}, "lastpass-csv", nil))
+}
@@ -0,0 +1,24 @@
+package mpw
+
+import (
+	"crypto/ecdh"
+)
+
+// WireGuard keys
+//
+// WireGuard uses Curve25519 key pairs. The private key is derived from the
+// site key in the WireGuard scope and clamped the way wg genkey clamps its
+// random keys, so that wg prints the same public key for it.
+const WireGuardScope = "com.github.emiljoha.mpw-go.wireguard"
+
+// WireGuardKey derives the Curve25519 private key of siteName.
+func WireGuardKey(masterKey []byte, siteName string, siteCounter int) (*ecdh.PrivateKey, error) {
+	key, err := DerivedKey(masterKey, WireGuardScope, siteName, siteCounter, 32)
+	if err != nil {
+		return nil, err
+	}
+	key[0] &= 248
+	key[31] &= 127
+	key[31] |= 64
+	return ecdh.X25519().NewPrivateKey(key)
+}
@@ -0,0 +1,43 @@
+package mpw
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWireGuardKey(t *testing.T) {
+	master, err := MasterKey("Robert Lee Mitchell", "banana colored duckling")
+	require.NoError(t, err)
+	key, err := WireGuardKey(master, "vpn.example.com", 1)
+	require.NoError(t, err)
+	private := key.Bytes()
+	require.Len(t, private, 32)
+	require.Zero(t, private[0]&7)
+	require.Equal(t, byte(64), private[31]&192)
+	require.Equal(t, "wLfGrW+tNqRYVIYpbqoBjzW37TEKaVvS/bxoqEFgMWg=", base64.StdEncoding.EncodeToString(private))
+	// As openssl pkey -pubout derives it from the private key.
+	require.Equal(t, "8vw6zDP/+3x3IwigQsbjNuwBDYuWPwnAvKKENrDc9hs=", base64.StdEncoding.EncodeToString(key.PublicKey().Bytes()))
+
+	again, err := WireGuardKey(master, "vpn.example.com", 1)
+	require.NoError(t, err)
+	require.True(t, key.Equal(again))
+	other, err := WireGuardKey(master, "vpn.example.com", 2)
+	require.NoError(t, err)
+	require.False(t, key.Equal(other))
+
+	// Both ends of a tunnel agree on the shared secret.
+	peer, err := WireGuardKey(master, "peer.example.com", 1)
+	require.NoError(t, err)
+	shared, err := key.ECDH(peer.PublicKey())
+	require.NoError(t, err)
+	peerShared, err := peer.ECDH(key.PublicKey())
+	require.NoError(t, err)
+	require.Equal(t, shared, peerShared)
+
+	public, err := ecdh.X25519().NewPublicKey(key.PublicKey().Bytes())
+	require.NoError(t, err)
+	require.True(t, public.Equal(key.PublicKey()))
+}
@@ -0,0 +1,158 @@
+package mpw
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Passphrases
+//
+// The Phrase template yields pronounceable but made up words. The Words
+// result type instead picks real words from the EFF large wordlist, which
+// are easier to type on phones and to remember.
+//
+// ´´´
+// stream = HKDF-Expand( <site key>, "words", ... )
+// value = UINT16( stream[2i..2i+1] ) for i = 0, 1, ...
+// skip value if value >= 65536 - 65536 % LEN( wordlist )
+// word = wordlist[ value % LEN( wordlist ) ]
+// ´´´
+//
+// Values that would make the first words of the list more likely than the
+// last ones are skipped, so every word is picked with equal probability and
+// each one adds log2(7776) ≈ 12.9 bits of entropy.
+const Words ResultType = "Words"
+
+// The EFF large wordlist, https://www.eff.org/dice, licensed under CC BY
+// 3.0 US by the Electronic Frontier Foundation.
+//
+//go:embed eff_large_wordlist.txt
+var effLargeWordlist string
+
+var (
+	wordlistOnce sync.Once
+	words        []string
+)
+
+// wordlist parses the embedded wordlist on first use.
+func wordlist() []string {
+	wordlistOnce.Do(func() {
+		for _, line := range strings.Split(strings.TrimSpace(effLargeWordlist), "\n") {
+			_, word, _ := strings.Cut(line, "\t")
+			words = append(words, word)
+		}
+	})
+	return words
+}
+
+type Capitalization string
+
+const (
+	Lowercase Capitalization = "lower"
+	Titlecase Capitalization = "title"
+	Uppercase Capitalization = "upper"
+)
+
+// PassphraseOptions shape the passphrases of the Words result type.
+type PassphraseOptions struct {
+	Words int `json:"words,omitempty"`
+	// Separator is the default if not set, and joins the words if empty.
+	Separator      *string        `json:"separator,omitempty"`
+	Capitalization Capitalization `json:"capitalization,omitempty"`
+}
+
+var defaultSeparator = " "
+
+// DefaultPassphraseOptions give six lower case words separated by spaces.
+var DefaultPassphraseOptions = PassphraseOptions{Words: 6, Separator: &defaultSeparator, Capitalization: Lowercase}
+
+// withDefaults fills in the options that are not set.
+func (o PassphraseOptions) withDefaults() PassphraseOptions {
+	if o.Words == 0 {
+		o.Words = DefaultPassphraseOptions.Words
+	}
+	if o.Separator == nil {
+		o.Separator = DefaultPassphraseOptions.Separator
+	}
+	if o.Capitalization == "" {
+		o.Capitalization = DefaultPassphraseOptions.Capitalization
+	}
+	return o
+}
+
+// String describes the passphrases with o, like 6 words, " ", lower.
+func (o PassphraseOptions) String() string {
+	o = o.withDefaults()
+	return fmt.Sprintf("%d words, %q, %s", o.Words, *o.Separator, o.Capitalization)
+}
+
+// Entropy is the number of bits of entropy of passphrases with o.
+func (o PassphraseOptions) Entropy() float64 {
+	return float64(o.withDefaults().Words) * math.Log2(float64(len(wordlist())))
+}
+
+// SitePassphrase renders the site key for purpose and context as a
+// passphrase of words.
+func SitePassphrase(masterKey []byte, siteName string, siteCounter int, purpose KeyPurpose, context string, options PassphraseOptions) (string, error) {
+	scope, found := scopes[purpose]
+	if !found {
+		return "", fmt.Errorf("key purpose %s not found", purpose)
+	}
+	site, err := siteKey(siteName, masterKey, uint(siteCounter), scope, context)
+	if err != nil {
+		return "", err
+	}
+	return passphrase(site, options)
+}
+
+func passphrase(siteKey []byte, options PassphraseOptions) (string, error) {
+	options = options.withDefaults()
+	if options.Words < 1 || options.Words > 64 {
+		return "", fmt.Errorf("passphrase of %d words not between 1 and 64 words", options.Words)
+	}
+	list := wordlist()
+	indices, err := wordIndices(hkdfExpand(siteKey, []byte("words"), 255*32), options.Words, len(list))
+	if err != nil {
+		return "", err
+	}
+	phrase := make([]string, 0, options.Words)
+	for _, i := range indices {
+		word := list[i]
+		switch options.Capitalization {
+		case Lowercase:
+		case Titlecase:
+			r, size := utf8.DecodeRuneInString(word)
+			word = string(unicode.ToUpper(r)) + word[size:]
+		case Uppercase:
+			word = strings.ToUpper(word)
+		default:
+			return "", fmt.Errorf("capitalization %s not found", options.Capitalization)
+		}
+		phrase = append(phrase, word)
+	}
+	return strings.Join(phrase, *options.Separator), nil
+}
+
+// wordIndices reads count unbiased indices below n from stream.
+func wordIndices(stream []byte, count int, n int) ([]int, error) {
+	limit := 65536 - 65536%n
+	indices := make([]int, 0, count)
+	for len(indices) < count {
+		if len(stream) < 2 {
+			return nil, errors.New("passphrase stream exhausted")
+		}
+		value := int(binary.BigEndian.Uint16(stream))
+		stream = stream[2:]
+		if value < limit {
+			indices = append(indices, value%n)
+		}
+	}
+	return indices, nil
+}
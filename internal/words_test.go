@@ -0,0 +1,77 @@
+package mpw
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWordlist(t *testing.T) {
+	list := wordlist()
+	require.Len(t, list, 7776)
+	require.Equal(t, "abacus", list[0])
+	require.Equal(t, "zoom", list[len(list)-1])
+}
+
+func TestWordIndices(t *testing.T) {
+	// 62208 = 65536 - 65536 % 7776 is the first value skipped.
+	stream := []byte{0x00, 0x01, 0xF3, 0x00, 0xFF, 0xFF, 0xF2, 0xFF, 0x1E, 0x60}
+	indices, err := wordIndices(stream, 3, 7776)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 62207 % 7776, 0x1E60 % 7776}, indices)
+	_, err = wordIndices(stream, 4, 7776)
+	require.Error(t, err)
+}
+
+func TestSitePassphrase(t *testing.T) {
+	master, err := MasterKey("Robert Lee Mitchell", "banana colored duckling")
+	require.NoError(t, err)
+	phrase, err := SitePassphrase(master, "masterpasswordapp.com", 1, Authentication, "", PassphraseOptions{})
+	require.NoError(t, err)
+	// Derived independently with Python's hashlib, following words.go.
+	require.Equal(t, "carpool woozy flypaper stomp pod thing", phrase)
+	words := strings.Split(phrase, " ")
+	require.Len(t, words, 6)
+	for _, word := range words {
+		require.Contains(t, wordlist(), word)
+	}
+	result, err := SiteResult(master, "masterpasswordapp.com", 1, Authentication, "", Words)
+	require.NoError(t, err)
+	require.Equal(t, phrase, result)
+
+	separator := "-"
+	options := PassphraseOptions{Words: 4, Separator: &separator, Capitalization: Titlecase}
+	titled, err := SitePassphrase(master, "masterpasswordapp.com", 1, Authentication, "", options)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join(words[:4], "-"), strings.ToLower(titled))
+	for _, word := range strings.Split(titled, "-") {
+		require.Equal(t, strings.ToUpper(word[:1]), word[:1])
+	}
+	joined := ""
+	together, err := SitePassphrase(master, "masterpasswordapp.com", 1, Authentication, "", PassphraseOptions{Separator: &joined})
+	require.NoError(t, err)
+	require.Equal(t, strings.Join(words, ""), together)
+	upper, err := SitePassphrase(master, "masterpasswordapp.com", 1, Authentication, "", PassphraseOptions{Capitalization: Uppercase})
+	require.NoError(t, err)
+	require.Equal(t, strings.ToUpper(phrase), upper)
+
+	other, err := SitePassphrase(master, "masterpasswordapp.com", 2, Authentication, "", PassphraseOptions{})
+	require.NoError(t, err)
+	require.NotEqual(t, phrase, other)
+	answer, err := SitePassphrase(master, "masterpasswordapp.com", 1, Recovery, "question", PassphraseOptions{})
+	require.NoError(t, err)
+	require.NotEqual(t, phrase, answer)
+
+	_, err = SitePassphrase(master, "masterpasswordapp.com", 1, Authentication, "", PassphraseOptions{Words: 65})
+	require.Error(t, err)
+	_, err = SitePassphrase(master, "masterpasswordapp.com", 1, Authentication, "", PassphraseOptions{Capitalization: "camel"})
+	require.Error(t, err)
+}
+
+func TestPassphraseEntropy(t *testing.T) {
+	require.InDelta(t, 6*math.Log2(7776), PassphraseOptions{}.Entropy(), 1e-9)
+	require.InDelta(t, 77.55, DefaultPassphraseOptions.Entropy(), 0.01)
+	require.InDelta(t, 4*12.925, PassphraseOptions{Words: 4}.Entropy(), 0.01)
+}